@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
@@ -8,35 +9,20 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
-	_ "studentgit.kata.academy/Zhodaran/go-kata/proxy/docs"
 
 	"studentgit.kata.academy/Zhodaran/go-kata/config"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
 
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/router"
 )
 
-// @title Address API
-// @version 1.0
-// @description API для поиска
-// @host localhost:8080
-// @BasePath
-// @securityDefinitions.apikey BearerAuth
-// @in header
-// @name Authorization
-
-// @RequestAddressSearch представляет запрNewUserControllerос для поиска
-// @Description Этот эндпоинт позволяет получить адрес по наименованию
-// @Param address body ResponseAddress true "Географические координаты"
-
-// TokenResponse представляет ответ с токеном
-
-// LoginResponse представляет ответ при успешном входе
+// Описание API строится из маршрутов при запуске и отдается по /openapi.json (см. proxy/router/openapi.go)
 
 func main() {
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	// .env нужен только при локальном запуске; в контейнере настройки и секреты приходят из окружения
+	if err := godotenv.Load("../.env"); err != nil {
+		log.Println("No .env file, using environment variables")
 	}
 	db, err := config.InitDB()
 	if err != nil {
@@ -50,6 +36,11 @@ func main() {
 	resp := controller.NewResponder(logger)
 	r := router.Router(resp, db)
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go postgres.StartBookPurger(purgeCtx, db, config.BookTrashRetention(), time.Hour)
+	go postgres.StartIdempotencyPurger(purgeCtx, db, time.Hour)
+
 	srv := &config.Server{
 		Server: http.Server{
 			Addr:         ":8080",
@@ -7,28 +7,27 @@ import (
 )
 
 type Book struct {
-	Index     int    `json:"index"`
-	Book      string `json:"book"`
-	Author    string `json:"author"`
-	Block     *bool  `json:"block"`
-	TakeCount int    `json:"take_count"`
+	Index     int     `json:"index"`
+	Book      string  `json:"book" validate:"required,max=50"`
+	Author    string  `json:"author" validate:"required,max=255"`
+	Block     *bool   `json:"block" validate:"required"`
+	TakeCount int     `json:"take_count"`
+	DeletedAt *string `json:"deleted_at,omitempty"` // Для логического удаления
 }
 
-// @Summary List SQL book
-// @Description This description created new SQL user
-// @Tags Books
-// @Accept json
-// @Produce json
-// @Success 200 {object} CreateResponse "List successful"
-// @Failure 400 {object} rErrorResponse "Invalid request"
-// @Failure 401 {object} rErrorResponse "Invalid credentials"
-// @Failure 500 {object} rErrorResponse "Internal server error"
-// @Router /api/books [get]
 func (uc *BookController) ListBook(w http.ResponseWriter, r *http.Request) {
 	// Получаем список книг из базы данных
 	books, err := uc.getBooksFromDB()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if uc.OnError != nil {
+			uc.OnError(w, r, err)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if uc.Output != nil {
+		uc.Output(w, r, books)
 		return
 	}
 
@@ -36,22 +35,19 @@ func (uc *BookController) ListBook(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // Устанавливаем статус 200 OK
 
-	// Кодируем и отправляем список книг
-	if err := json.NewEncoder(w).Encode(books); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	// Кодируем и отправляем список книг; статус уже отправлен, поэтому ошибку записи клиенту не сообщить
+	json.NewEncoder(w).Encode(books)
 }
 
 func (uc *BookController) getBooksFromDB() ([]Book, error) {
-	query := "SELECT index, book, author, block, take_count FROM book"
+	query := "SELECT index, book, author, block, take_count FROM book WHERE deleted_at IS NULL"
 	rows, err := uc.DB.QueryContext(context.Background(), query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var books []Book
+	books := []Book{} // Пустой каталог отдается как [], а не null
 	for rows.Next() {
 		var book Book
 		if err := rows.Scan(&book.Index, &book.Book, &book.Author, &book.Block, &book.TakeCount); err != nil {
@@ -7,6 +7,10 @@ import (
 
 type BookController struct {
 	DB *sql.DB
+	// OnError отвечает клиенту при ошибке; роутер подставляет общий формат ошибок API
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+	// Output отвечает списком книг; роутер подставляет выбор формата по Accept, без него ответ — JSON
+	Output func(w http.ResponseWriter, r *http.Request, v interface{})
 }
 
 type Server struct {
@@ -5,9 +5,12 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -15,7 +18,7 @@ import (
 func (s *Server) Serve() {
 	log.Println("Starting server...")
 	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server error: &v", err)
+		log.Fatalf("Server error: %v", err)
 	}
 }
 
@@ -55,3 +58,267 @@ func InitDB() (*sql.DB, error) {
 	)
 	return sql.Open("postgres", connStr)
 }
+
+// durationEnv читает длительность из переменной окружения или возвращает значение по умолчанию
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// intEnv читает положительное целое из переменной окружения или возвращает значение по умолчанию
+func intEnv(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// secretEnv читает секрет из файла, путь к которому задан в NAME_FILE (например, Docker secret), иначе из NAME
+func secretEnv(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// AdminConfig — первый администратор, который создается при запуске, если его еще нет
+type AdminConfig struct {
+	Username string // ADMIN_USERNAME; пусто — администратор не создается
+	Password string // ADMIN_PASSWORD или ADMIN_PASSWORD_FILE; меняется при первом входе
+}
+
+func AdminSettings() (AdminConfig, error) {
+	password, err := secretEnv("ADMIN_PASSWORD")
+	if err != nil {
+		return AdminConfig{}, err
+	}
+	return AdminConfig{Username: os.Getenv("ADMIN_USERNAME"), Password: password}, nil
+}
+
+// DemoUsers возвращает число демонстрационных пользователей для разработки (DEMO_USERS); 0 — не создавать
+func DemoUsers() int {
+	return intEnv("DEMO_USERS", 0)
+}
+
+// TrustedProxies разбирает TRUSTED_PROXIES — адреса или сети CIDR через запятую, чьим заголовкам
+// X-Forwarded-For и X-Real-IP можно верить. По умолчанию пусто: адрес клиента берется из соединения.
+func TrustedProxies() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// BookTrashRetention возвращает срок хранения удаленных книг в корзине
+func BookTrashRetention() time.Duration {
+	return durationEnv("BOOK_TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// AccessTokenTTL возвращает срок действия токена доступа
+func AccessTokenTTL() time.Duration {
+	return durationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL возвращает срок действия токена обновления
+func RefreshTokenTTL() time.Duration {
+	return durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// IdempotencyKeyTTL возвращает срок, в течение которого повтор запроса с тем же Idempotency-Key получает сохраненный ответ
+func IdempotencyKeyTTL() time.Duration {
+	return durationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+}
+
+// IdempotentRequestTimeout возвращает срок выполнения запроса с Idempotency-Key; пока он не прошел,
+// повтор с тем же ключом получает 409, а не выполняется второй раз
+func IdempotentRequestTimeout() time.Duration {
+	return durationEnv("IDEMPOTENT_REQUEST_TIMEOUT", 30*time.Second)
+}
+
+// LoanConfig задает срок выдачи книги и число его продлений
+type LoanConfig struct {
+	Period      time.Duration // LOAN_PERIOD: срок выдачи и каждого продления
+	MaxRenewals int           // LOAN_MAX_RENEWALS: сколько раз читатель может продлить выдачу
+}
+
+func LoanSettings() LoanConfig {
+	return LoanConfig{
+		Period:      durationEnv("LOAN_PERIOD", 14*24*time.Hour),
+		MaxRenewals: intEnv("LOAN_MAX_RENEWALS", 2),
+	}
+}
+
+// JWTConfig описывает ключи подписи и ожидаемые claims токенов доступа
+type JWTConfig struct {
+	Keys        string // JWT_KEYS: "kid:alg:path[,kid:alg:path...]"
+	ActiveKeyID string // JWT_ACTIVE_KEY_ID: ключ, которым подписываются новые токены
+	Secret      string // JWT_SECRET или файл из JWT_SECRET_FILE: общий HS256 секрет, если JWT_KEYS не заданы
+	Issuer      string
+	Audience    string
+}
+
+func JWTSettings() (JWTConfig, error) {
+	secret, err := secretEnv("JWT_SECRET")
+	if err != nil {
+		return JWTConfig{}, err
+	}
+	return JWTConfig{
+		Keys:        os.Getenv("JWT_KEYS"),
+		ActiveKeyID: os.Getenv("JWT_ACTIVE_KEY_ID"),
+		Secret:      secret,
+		Issuer:      os.Getenv("JWT_ISSUER"),
+		Audience:    os.Getenv("JWT_AUDIENCE"),
+	}, nil
+}
+
+// LoginThrottleConfig задает пороги блокировки входа после неудачных попыток
+type LoginThrottleConfig struct {
+	AccountMaxFailures int           // LOGIN_ACCOUNT_MAX_FAILURES: неудач подряд до блокировки учетной записи
+	IPMaxFailures      int           // LOGIN_IP_MAX_FAILURES: неудач с одного IP до его блокировки
+	BaseLockout        time.Duration // LOGIN_LOCKOUT_BASE: первая блокировка, далее удваивается
+	MaxLockout         time.Duration // LOGIN_LOCKOUT_MAX: предел блокировки
+	FailureWindow      time.Duration // LOGIN_FAILURE_WINDOW: через сколько без неудач счетчик сбрасывается
+}
+
+func LoginThrottleSettings() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		AccountMaxFailures: intEnv("LOGIN_ACCOUNT_MAX_FAILURES", 5),
+		IPMaxFailures:      intEnv("LOGIN_IP_MAX_FAILURES", 20),
+		BaseLockout:        durationEnv("LOGIN_LOCKOUT_BASE", time.Minute),
+		MaxLockout:         durationEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+		FailureWindow:      durationEnv("LOGIN_FAILURE_WINDOW", 24*time.Hour),
+	}
+}
+
+// MailConfig описывает отправку писем; без SMTP_ADDR письма остаются во внутренней очереди процесса
+type MailConfig struct {
+	SMTPAddr     string // SMTP_ADDR: "host:port"
+	SMTPUsername string
+	SMTPPassword string
+	From         string        // MAIL_FROM: адрес отправителя
+	BaseURL      string        // PUBLIC_BASE_URL: адрес сайта для ссылок в письмах
+	VerifyTTL    time.Duration // EMAIL_VERIFY_TTL: срок действия ссылки подтверждения адреса
+	ResetTTL     time.Duration // PASSWORD_RESET_TTL: срок действия ссылки сброса пароля
+}
+
+func MailSettings() MailConfig {
+	cfg := MailConfig{
+		SMTPAddr:     os.Getenv("SMTP_ADDR"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		From:         os.Getenv("MAIL_FROM"),
+		BaseURL:      os.Getenv("PUBLIC_BASE_URL"),
+		VerifyTTL:    durationEnv("EMAIL_VERIFY_TTL", 48*time.Hour),
+		ResetTTL:     durationEnv("PASSWORD_RESET_TTL", time.Hour),
+	}
+	if cfg.From == "" {
+		cfg.From = "no-reply@golibrary.local"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost"
+	}
+	return cfg
+}
+
+// OIDCConfig описывает вход через внешнего OpenID Connect провайдера; вход отключен без OIDC_ISSUER
+type OIDCConfig struct {
+	Issuer       string // OIDC_ISSUER
+	ClientID     string // OIDC_CLIENT_ID
+	ClientSecret string // OIDC_CLIENT_SECRET: пусто для публичного клиента
+	RedirectURL  string // OIDC_REDIRECT_URL: адрес /api/oidc/callback этого сервиса
+	GroupsClaim  string // OIDC_GROUPS_CLAIM: claim со списком групп
+	RoleMap      string // OIDC_ROLE_MAP: "группа:роль[,группа:роль...]"
+}
+
+func OIDCSettings() OIDCConfig {
+	cfg := OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		RoleMap:      os.Getenv("OIDC_ROLE_MAP"),
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return cfg
+}
+
+// MFAConfig задает параметры второго фактора
+type MFAConfig struct {
+	Issuer        string   // MFA_ISSUER: название сервиса в приложении-аутентификаторе
+	RequiredRoles []string // MFA_REQUIRED_ROLES: роли, которым вход без второго фактора запрещен
+}
+
+func MFASettings() MFAConfig {
+	cfg := MFAConfig{Issuer: os.Getenv("MFA_ISSUER")}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "GoLibrary"
+	}
+	for _, role := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			cfg.RequiredRoles = append(cfg.RequiredRoles, role)
+		}
+	}
+	return cfg
+}
+
+// APIVersionConfig задает сроки вывода из обращения /api/v1 (и адресов /api без версии)
+type APIVersionConfig struct {
+	V1DeprecatedAt time.Time // API_V1_DEPRECATED_AT: дата объявления v1 устаревшей, YYYY-MM-DD
+	V1Sunset       time.Time // API_V1_SUNSET: дата, после которой v1 может быть отключена, YYYY-MM-DD
+}
+
+func APIVersionSettings() APIVersionConfig {
+	return APIVersionConfig{
+		V1DeprecatedAt: dateEnv("API_V1_DEPRECATED_AT", time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)),
+		V1Sunset:       dateEnv("API_V1_SUNSET", time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)),
+	}
+}
+
+// ContractCheck возвращает режим сверки запросов и ответов с OpenAPI документом (API_CONTRACT_CHECK):
+// off — выключена (по умолчанию), log — нарушения пишутся в лог, reject — запросы с нарушениями
+// отклоняются, а ответы с нарушениями заменяются на 500. Сверка буферизует ответы, поэтому
+// включается только в разработке и тестах.
+func ContractCheck() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("API_CONTRACT_CHECK"))); mode {
+	case "log", "reject":
+		return mode
+	}
+	return "off"
+}
+
+// dateEnv читает дату в формате YYYY-MM-DD (UTC) из переменной окружения или возвращает значение по умолчанию
+func dateEnv(name string, fallback time.Time) time.Time {
+	value, err := time.Parse("2006-01-02", os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+)
+
+// Режимы выполнения пакета операций
+const (
+	BatchAtomic      = "atomic"      // Все операции в одной транзакции: ошибка одной отменяет все
+	BatchIndependent = "independent" // Каждая операция в своей транзакции
+)
+
+// BatchRequest — пакет операций над книгами, например корзина возвратов библиотекаря
+type BatchRequest struct {
+	Mode       string           `json:"mode,omitempty" validate:"oneof=atomic independent"` // По умолчанию atomic
+	Operations []BatchOperation `json:"operations" validate:"required,max=100"`             // Не больше 100 операций
+}
+
+type BatchOperation struct {
+	Op       string       `json:"op" validate:"required,oneof=take return update delete"`
+	Index    int          `json:"index" validate:"required,min=1"`
+	Username string       `json:"username,omitempty"` // take и return: читатель, за которого действует библиотекарь
+	Book     *config.Book `json:"book,omitempty"`     // update: новые название, автор и признак выдачи
+}
+
+// BatchResult — итог одной операции: статус, который вернул бы отдельный запрос, и книга или ошибка
+type BatchResult struct {
+	Status int              `json:"status"`
+	Book   *config.Book     `json:"book,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode    string        `json:"mode"`
+	Results []BatchResult `json:"results"` // В порядке операций запроса
+}
+
+// BatchBooks выполняет до 100 операций take, return, update и delete. В режиме atomic (по умолчанию) они идут
+// в одной транзакции, и первая ошибка отменяет остальные с ответом 424; в режиме independent каждая
+// операция фиксируется сама. Результаты идут в порядке операций.
+func BatchBooks(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := service.FromContext(r.Context())
+		if !ok {
+			resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
+			return
+		}
+
+		var request BatchRequest
+		if err := validate.DecodeJSON(w, r, &request); err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		if invalid := batchFields(request.Operations); len(invalid) > 0 {
+			resp.Error(w, r, problem.Validation(invalid...))
+			return
+		}
+		if request.Mode == "" {
+			request.Mode = BatchAtomic
+		}
+
+		b := &batch{ctx: r.Context(), db: db, identity: identity, books: Books, library: library}
+		var results []BatchResult
+		if request.Mode == BatchIndependent {
+			results = b.runIndependent(request.Operations)
+		} else {
+			var err error
+			if results, err = b.runAtomic(request.Operations); err != nil {
+				resp.Error(w, r, err)
+				return
+			}
+		}
+		resp.OutputJSON(w, BatchResponse{Mode: request.Mode, Results: results})
+	}
+}
+
+// batchFields проверяет операции до выполнения; имена полей указывают на операцию, например operations[2].op
+func batchFields(operations []BatchOperation) []problem.FieldError {
+	var invalid []problem.FieldError
+	prefix := func(fields []problem.FieldError, path string) {
+		for _, field := range fields {
+			field.Field = path + "." + field.Field
+			field.Message = path + "." + field.Message
+			invalid = append(invalid, field)
+		}
+	}
+	for i, op := range operations {
+		path := "operations[" + strconv.Itoa(i) + "]"
+		prefix(validate.Fields(op), path)
+		if op.Op != "update" {
+			continue
+		}
+		if op.Book == nil {
+			invalid = append(invalid, problem.Field(path+".book", "required", path+".book is required for update"))
+			continue
+		}
+		prefix(validate.Fields(op.Book), path+".book")
+	}
+	return invalid
+}
+
+// batch выполняет операции пакета от имени пользователя из токена
+type batch struct {
+	ctx      context.Context
+	db       *sql.DB
+	identity service.Identity
+	books    *[]config.Book
+	library  *Library
+}
+
+// batchStep — операция, выполненная в транзакции: ее результат и изменение списков в памяти после фиксации
+type batchStep struct {
+	result BatchResult
+	apply  func()
+}
+
+func (b *batch) runAtomic(operations []BatchOperation) ([]BatchResult, error) {
+	tx, err := b.db.BeginTx(b.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]BatchResult, len(operations))
+	steps := make([]batchStep, 0, len(operations))
+	for i, op := range operations {
+		step, err := b.run(tx, op)
+		var p *problem.Problem
+		if errors.As(err, &p) {
+			aborted := problem.New(http.StatusFailedDependency, problem.CodeBatchAborted,
+				fmt.Sprintf("not applied because operation %d failed", i))
+			for j := range results {
+				results[j] = BatchResult{Status: aborted.Status, Error: aborted}
+			}
+			results[i] = BatchResult{Status: p.Status, Error: p}
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[i] = step.result
+		steps = append(steps, step)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		step.apply()
+	}
+	return results, nil
+}
+
+func (b *batch) runIndependent(operations []BatchOperation) []BatchResult {
+	results := make([]BatchResult, len(operations))
+	for i, op := range operations {
+		step, err := b.runAlone(op)
+		var p *problem.Problem
+		switch {
+		case errors.As(err, &p):
+			results[i] = BatchResult{Status: p.Status, Error: p}
+		case err != nil:
+			log.Printf("Batch operation %d (%s %d) failed: %v", i, op.Op, op.Index, err)
+			results[i] = BatchResult{Status: http.StatusInternalServerError, Error: problem.InternalError()}
+		default:
+			results[i] = step.result
+		}
+	}
+	return results
+}
+
+// runAlone выполняет операцию в собственной транзакции
+func (b *batch) runAlone(op BatchOperation) (batchStep, error) {
+	tx, err := b.db.BeginTx(b.ctx, nil)
+	if err != nil {
+		return batchStep{}, err
+	}
+	defer tx.Rollback()
+
+	step, err := b.run(tx, op)
+	if err != nil {
+		return batchStep{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return batchStep{}, err
+	}
+	step.apply()
+	return step, nil
+}
+
+// run выполняет операцию в транзакции tx с теми же проверками прав и ответами, что и отдельные запросы в v2
+func (b *batch) run(tx *sql.Tx, op BatchOperation) (batchStep, error) {
+	switch op.Op {
+	case "take", "return":
+		if !b.identity.Can(service.PermLoansOwn) && !b.identity.Can(service.PermLoansOnBehalf) {
+			return batchStep{}, problem.Forbidden(problem.CodeForbidden, "insufficient permissions")
+		}
+		userID, username, err := resolvePatron(b.ctx, b.db, b.identity, op.Username)
+		if err != nil {
+			return batchStep{}, err
+		}
+		if op.Op == "take" {
+			if err := lendBook(b.ctx, tx, userID, op.Index); err != nil {
+				return batchStep{}, err
+			}
+			book, err := getBookByIndex(b.ctx, tx, op.Index)
+			if err != nil {
+				return batchStep{}, err
+			}
+			return batchStep{
+				result: BatchResult{Status: http.StatusCreated, Book: &book},
+				apply:  func() { rememberLoan(b.books, b.library, username, op.Index) },
+			}, nil
+		}
+		if err := receiveBook(b.ctx, tx, userID, op.Index); err != nil {
+			return batchStep{}, err
+		}
+		book, err := getBookByIndex(b.ctx, tx, op.Index)
+		if err != nil {
+			return batchStep{}, err
+		}
+		return batchStep{
+			result: BatchResult{Status: http.StatusNoContent},
+			apply:  func() { forgetLoan(b.books, b.library, username, book) },
+		}, nil
+	}
+
+	if !b.identity.Can(service.PermBooksWrite) {
+		return batchStep{}, problem.Forbidden(problem.CodeForbidden, "insufficient permissions")
+	}
+	if op.Op == "update" {
+		if err := replaceBook(b.ctx, tx, op.Index, *op.Book); err != nil {
+			return batchStep{}, err
+		}
+		book, err := getBookByIndex(b.ctx, tx, op.Index)
+		if err != nil {
+			return batchStep{}, err
+		}
+		return batchStep{result: BatchResult{Status: http.StatusOK, Book: &book}, apply: func() {}}, nil
+	}
+	book, err := trashBook(b.ctx, tx, op.Index)
+	if err != nil {
+		return batchStep{}, err
+	}
+	return batchStep{
+		result: BatchResult{Status: http.StatusOK, Book: &book},
+		apply:  func() { forgetBook(b.books, b.library, book) },
+	}, nil
+}
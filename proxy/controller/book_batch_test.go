@@ -0,0 +1,463 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+// libraryDB — база в памяти, которая понимает запросы пакетных операций над книгами.
+// Транзакция запоминает состояние при начале и восстанавливает его при откате.
+type libraryDB struct {
+	mu       sync.Mutex
+	state    libraryState
+	saved    *libraryState
+	failWith string // Запрос с этим началом завершается ошибкой базы
+}
+
+type libraryState struct {
+	books map[int]fakeBook
+	loans []fakeLoan
+	holds []fakeHold
+	users map[string]string // id → логин
+}
+
+type fakeBook struct {
+	title, author  string
+	block, deleted bool
+	takeCount      int
+}
+
+type fakeLoan struct {
+	userID   string
+	index    int
+	returned bool
+}
+
+type fakeHold struct {
+	userID string
+	index  int
+	closed bool
+}
+
+func (s libraryState) clone() libraryState {
+	c := libraryState{books: make(map[int]fakeBook, len(s.books)), loans: append([]fakeLoan{}, s.loans...),
+		holds: append([]fakeHold{}, s.holds...), users: s.users}
+	for index, book := range s.books {
+		c.books[index] = book
+	}
+	return c
+}
+
+func (d *libraryDB) Connect(context.Context) (driver.Conn, error) { return libraryConn{d}, nil }
+func (d *libraryDB) Driver() driver.Driver                        { return nil }
+
+type libraryConn struct{ db *libraryDB }
+
+func (c libraryConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c libraryConn) Close() error { return nil }
+
+func (c libraryConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	saved := c.db.state.clone()
+	c.db.saved = &saved
+	return c, nil
+}
+
+func (c libraryConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.saved = nil
+	return nil
+}
+
+func (c libraryConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.state, c.db.saved = *c.db.saved, nil
+	return nil
+}
+
+func (c libraryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.(*fakeRows).values)), nil
+}
+
+// QueryContext выполняет запрос; для UPDATE и INSERT возвращает по строке на каждую измененную запись
+func (c libraryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	s := &c.db.state
+	query = strings.TrimSpace(query)
+	if c.db.failWith != "" && strings.HasPrefix(query, c.db.failWith) {
+		return nil, errors.New("connection reset")
+	}
+	arg := func(i int) interface{} { return args[i].Value }
+	index := func(i int) int { return int(args[i].Value.(int64)) }
+	rows := &fakeRows{}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT username FROM users WHERE id = $1"):
+		if name, ok := s.users[arg(0).(string)]; ok {
+			rows.add(name)
+		}
+	case strings.HasPrefix(query, "SELECT id FROM users WHERE username = $1"):
+		for id, name := range s.users {
+			if name == arg(0) {
+				rows.add(id)
+			}
+		}
+	case strings.HasPrefix(query, "SELECT index, book, author, block, take_count FROM book WHERE index = $1"):
+		if book, ok := s.books[index(0)]; ok && !book.deleted {
+			rows.add(int64(index(0)), book.title, book.author, book.block, int64(book.takeCount))
+		}
+	case strings.HasPrefix(query, "UPDATE book SET block = $1, take_count = take_count + 1"):
+		if book, ok := s.books[index(1)]; ok && !book.deleted && !book.block {
+			book.block, book.takeCount = true, book.takeCount+1
+			s.books[index(1)] = book
+			rows.add(nil)
+		}
+	case strings.HasPrefix(query, "INSERT INTO loans"):
+		s.loans = append(s.loans, fakeLoan{userID: arg(0).(string), index: index(1)})
+		rows.add(nil)
+	case strings.HasPrefix(query, "INSERT INTO holds"):
+		if !s.holding(arg(0).(string), index(1)) {
+			s.holds = append(s.holds, fakeHold{userID: arg(0).(string), index: index(1)})
+			rows.add(int64(len(s.holds)), time.Date(2026, 1, 1, 0, 0, len(s.holds), 0, time.UTC))
+		}
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM holds"):
+		position := 0
+		for id, hold := range s.holds {
+			if hold.index == index(0) && !hold.closed && int64(id+1) <= args[2].Value.(int64) {
+				position++
+			}
+		}
+		rows.add(int64(position))
+	case strings.HasPrefix(query, "UPDATE holds SET closed_at = NOW()"):
+		for i, hold := range s.holds {
+			if hold.userID == arg(0) && hold.index == index(1) && !hold.closed {
+				s.holds[i].closed = true
+				rows.add(nil)
+			}
+		}
+	case strings.HasPrefix(query, "UPDATE loans SET returned_at = NOW()"):
+		for i, loan := range s.loans {
+			if loan.userID == arg(0) && loan.index == index(1) && !loan.returned {
+				s.loans[i].returned = true
+				rows.add(nil)
+			}
+		}
+	case strings.HasPrefix(query, "UPDATE book SET block = $1 WHERE index = $2"):
+		if book, ok := s.books[index(1)]; ok && book.block {
+			book.block = false
+			s.books[index(1)] = book
+			rows.add(nil)
+		}
+	case strings.HasPrefix(query, "UPDATE book SET book = $1, author = $2, block = $3"):
+		if book, ok := s.books[index(3)]; ok && !book.deleted {
+			book.title, book.author, book.block = arg(0).(string), arg(1).(string), arg(2).(bool)
+			s.books[index(3)] = book
+			rows.add(nil)
+		}
+	case strings.HasPrefix(query, "UPDATE book SET deleted_at = NOW()"):
+		if book, ok := s.books[index(0)]; ok && !book.deleted && !book.block {
+			book.deleted = true
+			s.books[index(0)] = book
+			rows.add("2026-01-01T00:00:00Z")
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	return rows, nil
+}
+
+// holding сообщает, есть ли у читателя действующая бронь на книгу
+func (s libraryState) holding(userID string, index int) bool {
+	for _, hold := range s.holds {
+		if hold.userID == userID && hold.index == index && !hold.closed {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+	next   int
+}
+
+func (r *fakeRows) add(values ...driver.Value) { r.values = append(r.values, values) }
+func (r *fakeRows) Columns() []string {
+	if len(r.values) == 0 {
+		return nil
+	}
+	return make([]string, len(r.values[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
+
+// newLibraryDB — книги 1–3 на полке, книга 4 выдана читателю 7; пользователи 7 (reader) и 8 (other)
+func newLibraryDB() *libraryDB {
+	return &libraryDB{state: libraryState{
+		books: map[int]fakeBook{
+			1: {title: "Dune", author: "Frank Herbert"},
+			2: {title: "Solaris", author: "Stanislaw Lem"},
+			3: {title: "Hyperion", author: "Dan Simmons"},
+			4: {title: "Ubik", author: "Philip K. Dick", block: true, takeCount: 1},
+		},
+		loans: []fakeLoan{{userID: "7", index: 4}},
+		users: map[string]string{"7": "reader", "8": "other"},
+	}}
+}
+
+var (
+	patron    = service.Identity{UserID: "7", Username: "reader", Role: "patron"}
+	librarian = service.Identity{UserID: "7", Username: "reader", Role: "librarian"}
+	loanKey   = service.Identity{UserID: "7", Username: "reader", Role: "librarian", APIKeyID: 1,
+		Scopes: []service.Permission{service.PermLoansOnBehalf}}
+)
+
+// batchResponse — ответ BatchBooks или ошибка всего запроса
+type batchResponse struct {
+	Mode    string `json:"mode"`
+	Results []struct {
+		Status int          `json:"status"`
+		Book   *config.Book `json:"book"`
+		Error  *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	} `json:"results"`
+	Code   string `json:"code"`
+	Errors []struct {
+		Field string `json:"field"`
+		Code  string `json:"code"`
+	} `json:"errors"`
+}
+
+func (b batchResponse) statuses() []int {
+	statuses := make([]int, len(b.Results))
+	for i, result := range b.Results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+func runBatch(t *testing.T, db *libraryDB, identity service.Identity, body string) (int, batchResponse) {
+	t.Helper()
+	books := []config.Book{}
+	handler := BatchBooks(NewResponder(zap.NewNop()), sql.OpenDB(db), &books, NewLibrary())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/books/batch", strings.NewReader(body))
+	req = req.WithContext(service.NewContext(req.Context(), identity))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var response batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %s: %v", rr.Body, err)
+	}
+	return rr.Code, response
+}
+
+func TestBatchBooks(t *testing.T) {
+	cases := []struct {
+		name     string
+		identity service.Identity
+		body     string
+		failWith string
+		status   int
+		results  []int
+		check    func(t *testing.T, s libraryState)
+	}{
+		{
+			name:     "atomic commits all operations",
+			identity: librarian,
+			body: `{"operations":[{"op":"take","index":1},{"op":"return","index":4},
+				{"op":"update","index":2,"book":{"book":"Solaris","author":"S. Lem","block":false}},{"op":"delete","index":3}]}`,
+			status:  http.StatusOK,
+			results: []int{http.StatusCreated, http.StatusNoContent, http.StatusOK, http.StatusOK},
+			check: func(t *testing.T, s libraryState) {
+				if !s.books[1].block || s.books[4].block || s.books[2].author != "S. Lem" || !s.books[3].deleted {
+					t.Errorf("Expected every operation to be applied, got %+v", s.books)
+				}
+			},
+		},
+		{
+			name:     "atomic rolls back on a failed operation",
+			identity: librarian,
+			body: `{"operations":[{"op":"take","index":1},{"op":"take","index":4},
+				{"op":"update","index":2,"book":{"book":"Solaris","author":"S. Lem","block":false}}]}`,
+			status:  http.StatusOK,
+			results: []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusFailedDependency},
+			check: func(t *testing.T, s libraryState) {
+				if s.books[1].block || s.books[1].takeCount != 0 || len(s.loans) != 1 || s.books[2].author != "Stanislaw Lem" {
+					t.Errorf("Expected rollback, got books %+v and loans %+v", s.books, s.loans)
+				}
+			},
+		},
+		{
+			name:     "atomic fails as a whole on a database error mid-batch",
+			identity: librarian,
+			body:     `{"operations":[{"op":"take","index":1},{"op":"return","index":4},{"op":"delete","index":3}]}`,
+			failWith: "UPDATE loans SET returned_at",
+			status:   http.StatusInternalServerError,
+			check: func(t *testing.T, s libraryState) {
+				if s.books[1].block || len(s.loans) != 1 || s.books[3].deleted {
+					t.Errorf("Expected rollback, got books %+v and loans %+v", s.books, s.loans)
+				}
+			},
+		},
+		{
+			name:     "independent commits each operation",
+			identity: librarian,
+			body: `{"mode":"independent","operations":[{"op":"take","index":1},{"op":"take","index":4},
+				{"op":"delete","index":4},{"op":"delete","index":3}]}`,
+			status:  http.StatusOK,
+			results: []int{http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusOK},
+			check: func(t *testing.T, s libraryState) {
+				if !s.books[1].block || len(s.loans) != 2 || !s.books[3].deleted || s.books[4].deleted {
+					t.Errorf("Expected successful operations to be committed, got books %+v and loans %+v", s.books, s.loans)
+				}
+			},
+		},
+		{
+			name:     "independent reports a database error for one operation",
+			identity: librarian,
+			body:     `{"mode":"independent","operations":[{"op":"take","index":1},{"op":"delete","index":3}]}`,
+			failWith: "UPDATE book SET deleted_at",
+			status:   http.StatusOK,
+			results:  []int{http.StatusCreated, http.StatusInternalServerError},
+		},
+		{
+			name:     "independent reports a missing book for update",
+			identity: librarian,
+			body:     `{"mode":"independent","operations":[{"op":"update","index":9,"book":{"book":"Solaris","author":"S. Lem","block":false}}]}`,
+			status:   http.StatusOK,
+			results:  []int{http.StatusNotFound},
+		},
+		{
+			name:     "patron cannot edit the catalog",
+			identity: patron,
+			body:     `{"mode":"independent","operations":[{"op":"take","index":1},{"op":"delete","index":3}]}`,
+			status:   http.StatusOK,
+			results:  []int{http.StatusCreated, http.StatusForbidden},
+		},
+		{
+			name:     "patron cannot take a book for another user",
+			identity: patron,
+			body:     `{"operations":[{"op":"take","index":1,"username":"other"}]}`,
+			status:   http.StatusOK,
+			results:  []int{http.StatusForbidden},
+		},
+		{
+			name:     "librarian takes a book for another user",
+			identity: librarian,
+			body:     `{"operations":[{"op":"take","index":1,"username":"other"}]}`,
+			status:   http.StatusOK,
+			results:  []int{http.StatusCreated},
+			check: func(t *testing.T, s libraryState) {
+				if s.loans[len(s.loans)-1].userID != "8" {
+					t.Errorf("Expected loan for user 8, got %+v", s.loans)
+				}
+			},
+		},
+		{
+			name:     "API key scopes limit operations",
+			identity: loanKey,
+			body:     `{"mode":"independent","operations":[{"op":"return","index":4},{"op":"update","index":2,"book":{"book":"S","author":"L","block":false}}]}`,
+			status:   http.StatusOK,
+			results:  []int{http.StatusNoContent, http.StatusForbidden},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := newLibraryDB()
+			db.failWith = c.failWith
+			status, response := runBatch(t, db, c.identity, c.body)
+			if status != c.status {
+				t.Fatalf("Expected status %d, got %d (%+v)", c.status, status, response)
+			}
+			if got := response.statuses(); fmt.Sprint(got) != fmt.Sprint(c.results) && c.results != nil {
+				t.Errorf("Expected results %v, got %v", c.results, got)
+			}
+			if c.check != nil {
+				c.check(t, db.state)
+			}
+		})
+	}
+}
+
+func TestBatchBooksValidation(t *testing.T) {
+	operations := make([]string, 101)
+	for i := range operations {
+		operations[i] = fmt.Sprintf(`{"op":"take","index":%d}`, i+1)
+	}
+
+	cases := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"more than 100 operations", `{"operations":[` + strings.Join(operations, ",") + `]}`, []string{"operations"}},
+		{"no operations", `{"operations":[]}`, []string{"operations"}},
+		{"unknown mode", `{"mode":"parallel","operations":[{"op":"take","index":1}]}`, []string{"mode"}},
+		{"unknown op and index", `{"operations":[{"op":"take","index":1},{"op":"lend","index":0}]}`,
+			[]string{"operations[1].op", "operations[1].index"}},
+		{"update without book", `{"operations":[{"op":"update","index":1}]}`, []string{"operations[0].book"}},
+		{"update with invalid book", `{"operations":[{"op":"update","index":1,"book":{"book":"","author":"A"}}]}`,
+			[]string{"operations[0].book.book", "operations[0].book.block"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := newLibraryDB()
+			status, response := runBatch(t, db, librarian, c.body)
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status %d, got %d (%+v)", http.StatusUnprocessableEntity, status, response)
+			}
+			var fields []string
+			for _, field := range response.Errors {
+				fields = append(fields, field.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(c.fields) {
+				t.Errorf("Expected invalid fields %v, got %v", c.fields, fields)
+			}
+			if db.state.books[1].block {
+				t.Error("Expected no operation to run")
+			}
+		})
+	}
+
+	exactly := `{"mode":"independent","operations":[` + strings.Join(operations[:100], ",") + `]}`
+	if status, response := runBatch(t, newLibraryDB(), librarian, exactly); status != http.StatusOK || len(response.Results) != 100 {
+		t.Errorf("Expected 100 operations to be accepted, got %d with %d results", status, len(response.Results))
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/lib/pq"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/fieldset"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// Связи книги, которые можно встроить в ответ через include=
+const (
+	IncludeAuthors     = "authors"
+	IncludeCurrentLoan = "current_loan"
+	IncludeHolds       = "holds"
+)
+
+var bookRelations = []string{IncludeAuthors, IncludeCurrentLoan, IncludeHolds}
+
+// patronRelations раскрывают id и логины читателей, у которых книга или которые стоят за ней в очереди
+var patronRelations = []string{IncludeCurrentLoan, IncludeHolds}
+
+// BookRelations загружает выдачи и брони сразу для всех книг ответа
+type BookRelations interface {
+	OpenLoansByBooks(ctx context.Context, indexes []int) ([]models.Loan, error)
+	HoldsByBooks(ctx context.Context, indexes []int) ([]models.Hold, error)
+}
+
+// Author — автор книги и число его книг в каталоге
+type Author struct {
+	Name  string `json:"name"`
+	Books int    `json:"books"`
+}
+
+// BookView — книга со связями. В ответе остаются только связи из include=: current_loan — null,
+// если книга на полке, holds — [], если брони нет.
+type BookView struct {
+	config.Book
+	Authors     []Author      `json:"authors"`
+	CurrentLoan *models.Loan  `json:"current_loan"`
+	Holds       []models.Hold `json:"holds"`
+}
+
+// bookSelection разбирает fields= и include= для книг
+func bookSelection(r *http.Request) (fieldset.Selection, error) {
+	return fieldset.Parse(r.URL.Query(), fieldset.Names(config.Book{}), bookRelations)
+}
+
+// authorizeRelations разрешает встраивать связи с данными читателей только тем, кто работает с книгами
+// за читателей: без входа — 401, без права loans:on_behalf — 403
+func authorizeRelations(ctx context.Context, sel fieldset.Selection) error {
+	for _, relation := range patronRelations {
+		if !sel.Includes(relation) {
+			continue
+		}
+		identity, ok := service.FromContext(ctx)
+		if !ok {
+			return problem.Unauthorized(problem.CodeUnauthorized, "include="+relation+" requires authentication")
+		}
+		if !identity.Can(service.PermLoansOnBehalf) {
+			return problem.Forbidden(problem.CodeForbidden, "include="+relation+" requires the loans:on_behalf permission")
+		}
+	}
+	return nil
+}
+
+// embedBooks встраивает в книги запрошенные связи: по одному запросу на связь для всего списка
+func embedBooks(ctx context.Context, db *sql.DB, relations BookRelations, books []config.Book, sel fieldset.Selection) ([]BookView, error) {
+	views := make([]BookView, len(books))
+	indexes := make([]int, len(books))
+	position := make(map[int]int, len(books))
+	for i, book := range books {
+		views[i].Book = book
+		indexes[i] = book.Index
+		position[book.Index] = i
+	}
+	if len(books) == 0 {
+		return views, nil
+	}
+
+	if sel.Includes(IncludeAuthors) {
+		authors, err := countAuthorBooks(ctx, db, books)
+		if err != nil {
+			return nil, err
+		}
+		for i, book := range books {
+			views[i].Authors = []Author{{Name: book.Author, Books: authors[book.Author]}}
+		}
+	}
+	if sel.Includes(IncludeCurrentLoan) {
+		loans, err := relations.OpenLoansByBooks(ctx, indexes)
+		if err != nil {
+			return nil, err
+		}
+		for _, loan := range loans {
+			loan := loan
+			views[position[loan.BookIndex]].CurrentLoan = &loan
+		}
+	}
+	if sel.Includes(IncludeHolds) {
+		holds, err := relations.HoldsByBooks(ctx, indexes)
+		if err != nil {
+			return nil, err
+		}
+		for i := range views {
+			views[i].Holds = []models.Hold{}
+		}
+		for _, hold := range holds {
+			i := position[hold.BookIndex]
+			views[i].Holds = append(views[i].Holds, hold)
+		}
+	}
+	return views, nil
+}
+
+// countAuthorBooks считает книги каталога у авторов из списка
+func countAuthorBooks(ctx context.Context, db *sql.DB, books []config.Book) (map[string]int, error) {
+	names := make([]string, 0, len(books))
+	for _, book := range books {
+		if !contains(names, book.Author) {
+			names = append(names, book.Author)
+		}
+	}
+	rows, err := db.QueryContext(ctx,
+		"SELECT author, COUNT(*) FROM book WHERE deleted_at IS NULL AND author = ANY($1) GROUP BY author", pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(names))
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/fieldset"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+func TestAuthorizeRelations(t *testing.T) {
+	cases := []struct {
+		query    string
+		identity *service.Identity
+		status   int // 0 — связи можно встроить
+	}{
+		{"include=authors", nil, 0},
+		{"include=current_loan", nil, http.StatusUnauthorized},
+		{"include=authors,holds", &patron, http.StatusForbidden},
+		{"include=current_loan", &loanKey, 0},
+		{"include=holds", &librarian, 0},
+	}
+	for _, c := range cases {
+		values, _ := url.ParseQuery(c.query)
+		sel, err := fieldset.Parse(values, nil, bookRelations)
+		if err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		ctx := context.Background()
+		if c.identity != nil {
+			ctx = service.NewContext(ctx, *c.identity)
+		}
+
+		err = authorizeRelations(ctx, sel)
+		var p *problem.Problem
+		switch {
+		case c.status == 0 && err != nil:
+			t.Errorf("%s as %v: unexpected error %v", c.query, c.identity, err)
+		case c.status != 0 && (!errors.As(err, &p) || p.Status != c.status):
+			t.Errorf("%s as %v: expected status %d, got %v", c.query, c.identity, c.status, err)
+		}
+	}
+}
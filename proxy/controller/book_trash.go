@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// DeleteBook помечает книгу удаленной и перемещает ее в корзину. Выданную книгу удалить нельзя.
+func DeleteBook(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		indexStr := chi.URLParam(r, "index")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil {
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "invalid index"))
+			return
+		}
+
+		book, err := trashBook(r.Context(), db, index)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		forgetBook(Books, library, book)
+
+		resp.OutputJSON(w, book)
+	}
+}
+
+// trashBook помечает книгу удаленной и возвращает ее; выданную книгу удалить нельзя
+func trashBook(ctx context.Context, q queryer, index int) (config.Book, error) {
+	book, err := getBookByIndex(ctx, q, index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return config.Book{}, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found", index))
+	}
+	if err != nil {
+		return config.Book{}, err
+	}
+
+	// Условие block = false защищает от гонки с одновременной выдачей книги
+	err = q.QueryRowContext(ctx,
+		"UPDATE book SET deleted_at = NOW() WHERE index = $1 AND deleted_at IS NULL AND block IS NOT TRUE RETURNING deleted_at",
+		index).Scan(&book.DeletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return config.Book{}, problem.Conflict(problem.CodeBookOnLoan, fmt.Sprintf("book with index %d is on loan", index))
+	}
+	if err != nil {
+		return config.Book{}, err
+	}
+	return book, nil
+}
+
+// forgetBook убирает удаленную книгу из списков в памяти
+func forgetBook(Books *[]config.Book, library *Library, book config.Book) {
+	for i, b := range *Books {
+		if b.Index == book.Index {
+			*Books = append((*Books)[:i], (*Books)[i+1:]...)
+			break
+		}
+	}
+	library.RemoveBook(book.Author, book.Index)
+}
+
+// ListDeletedBooks возвращает книги, находящиеся в корзине
+func ListDeletedBooks(resp Responder, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.QueryContext(r.Context(),
+			"SELECT index, book, author, block, take_count, deleted_at FROM book WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		books := []config.Book{}
+		for rows.Next() {
+			var book config.Book
+			if err := rows.Scan(&book.Index, &book.Book, &book.Author, &book.Block, &book.TakeCount, &book.DeletedAt); err != nil {
+				resp.Error(w, r, err)
+				return
+			}
+			books = append(books, book)
+		}
+		if err := rows.Err(); err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+
+		resp.Negotiate(w, r, books)
+	}
+}
+
+// RestoreBook снимает с книги отметку об удалении
+func RestoreBook(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		indexStr := chi.URLParam(r, "index")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil {
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "invalid index"))
+			return
+		}
+
+		var book config.Book
+		err = db.QueryRowContext(r.Context(),
+			"UPDATE book SET deleted_at = NULL WHERE index = $1 AND deleted_at IS NOT NULL RETURNING index, book, author, block, take_count",
+			index).Scan(&book.Index, &book.Book, &book.Author, &book.Block, &book.TakeCount)
+		if errors.Is(err, sql.ErrNoRows) {
+			resp.Error(w, r, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found in trash", index)))
+			return
+		}
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+
+		*Books = append(*Books, book)
+		library.AddBooks([]config.Book{book})
+
+		resp.OutputJSON(w, book)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"sync"
@@ -14,6 +15,11 @@ import (
 	"go.uber.org/zap"
 	"studentgit.kata.academy/Zhodaran/go-kata/config"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/negotiate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/patch"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
 )
 
 type Response struct {
@@ -22,12 +28,6 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-type mErrorResponse struct {
-	BadRequest      string `json:"400"`
-	DadataBad       string `json:"500"`
-	SuccefulRequest string `json:"200"`
-}
-
 type GeocodeRequest struct {
 	Lat float64 `json:"lat"`
 	Lng float64 `json:"lng"`
@@ -40,10 +40,16 @@ type RequestAddressSearch struct {
 type Responder interface {
 	OutputJSON(w http.ResponseWriter, responseData interface{})
 
-	ErrorUnauthorized(w http.ResponseWriter, err error)
-	ErrorBadRequest(w http.ResponseWriter, err error)
-	ErrorForbidden(w http.ResponseWriter, err error)
-	ErrorInternal(w http.ResponseWriter, err error)
+	// Negotiate отвечает 200 в формате из заголовка Accept: JSON (по умолчанию), CSV, XML или MessagePack;
+	// если ни один не подходит — 406
+	Negotiate(w http.ResponseWriter, r *http.Request, responseData interface{})
+
+	// Created отвечает 201 с созданным ресурсом и его адресом в заголовке Location
+	Created(w http.ResponseWriter, location string, responseData interface{})
+
+	// Error отвечает application/problem+json: статус и код берутся из *problem.Problem,
+	// любая другая ошибка считается внутренней и отдается как 500 без подробностей
+	Error(w http.ResponseWriter, r *http.Request, err error)
 }
 
 func (l *Library) AddBook(book config.Book) {
@@ -81,6 +87,20 @@ func (l *Library) AddBook(book config.Book) {
 	}
 }
 
+// RemoveBook убирает книгу автора из библиотеки
+func (l *Library) RemoveBook(author string, index int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	booksByAuthor := l.Books[author]
+	for i, b := range booksByAuthor {
+		if b.Index == index {
+			l.Books[author] = append(booksByAuthor[:i], booksByAuthor[i+1:]...)
+			return
+		}
+	}
+}
+
 func contains(authors []string, author string) bool {
 	for _, a := range authors {
 		if a == author {
@@ -132,263 +152,416 @@ func (r *Respond) OutputJSON(w http.ResponseWriter, responseData interface{}) {
 	}
 }
 
-func (r *Respond) ErrorBadRequest(w http.ResponseWriter, err error) {
-	r.log.Info("http response bad request status code", zap.Error(err))
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusBadRequest)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
-		r.log.Info("response writer error on write", zap.Error(err))
+func (rs *Respond) Negotiate(w http.ResponseWriter, r *http.Request, responseData interface{}) {
+	if err := negotiate.Write(w, r, http.StatusOK, responseData); err != nil {
+		rs.Error(w, r, err)
 	}
 }
 
-func (r *Respond) ErrorForbidden(w http.ResponseWriter, err error) {
-	r.log.Warn("http resposne forbidden", zap.Error(err))
+func (r *Respond) Created(w http.ResponseWriter, location string, responseData interface{}) {
 	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusForbidden)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
-		r.log.Error("response writer error on write", zap.Error(err))
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(responseData); err != nil {
+		r.log.Error("responder json encode error", zap.Error(err))
 	}
 }
 
-func (r *Respond) ErrorUnauthorized(w http.ResponseWriter, err error) {
-	r.log.Warn("http resposne Unauthorized", zap.Error(err))
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusUnauthorized)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
-		r.log.Error("response writer error on write", zap.Error(err))
+func (rs *Respond) Error(w http.ResponseWriter, r *http.Request, err error) {
+	var p *problem.Problem
+	if errors.As(err, &p) {
+		if p.Status >= http.StatusInternalServerError {
+			rs.log.Error("http response error", zap.Int("status", p.Status), zap.Error(err))
+		} else {
+			rs.log.Info("http response error", zap.Int("status", p.Status), zap.String("code", p.Code), zap.Error(err))
+		}
+		problem.Render(w, r, p)
+		return
 	}
-}
-
-func (r *Respond) ErrorInternal(w http.ResponseWriter, err error) {
 	if errors.Is(err, context.Canceled) {
 		return
 	}
-	r.log.Error("http response internal error", zap.Error(err))
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusInternalServerError)
-	if err := json.NewEncoder(w).Encode(Response{
-		Success: false,
-		Message: err.Error(),
-		Data:    nil,
-	}); err != nil {
-		r.log.Error("response writer error on write", zap.Error(err))
-	}
+	rs.log.Error("http response internal error", zap.String("path", r.URL.Path), zap.Error(err))
+	problem.Render(w, r, problem.InternalError())
 }
 
 type TakeBookRequest struct {
-	Username string `json:"username"` // Поле для имени пользователя
-}
-
-// @Summary Get Geo Coordinates by Address
-// @Description This endpoint allows you to get geo coordinates by address.
-// @Tags User
-// @Accept json
-// @Produce json
-// @Param index path int true "Book INDEX"
-// @Param Authorization header string true "Bearer Token"
-// @Param body body TakeBookRequest true "Request body"
-// @Success 200 {object} Response "Успешное выполнение"
-// @Failure 400 {object} mErrorResponse "Ошибка запроса"
-// @Failure 500 {object} mErrorResponse "Ошибка подключения к серверу"
-// @Security BearerAuth
-// @Router /api/book/take/{index} [post]
+	Username string `json:"username,omitempty"` // Необязательно; должно совпадать с пользователем из токена
+}
+
+// TakeBookHandler выдает книгу пользователю из токена, а библиотекарь может выдать ее пользователю из тела запроса
 func TakeBookHandler(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		indexStr := chi.URLParam(r, "index")
-		index, err := strconv.Atoi(indexStr)
-		if err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid index"))
+		if _, ok := takeBook(w, r, resp, db, Books, library); !ok {
 			return
 		}
+		resp.OutputJSON(w, map[string]string{"message": "Book taken successfully"})
+	}
+}
 
-		// Обновление записи в таблице book
-		result, err := db.Exec("UPDATE book SET block = $1, take_count = take_count + 1 WHERE index = $2 AND block = $3", true, index, false)
-		if err != nil {
-			resp.ErrorInternal(w, err)
-			return
-		}
+// takeBook выдает книгу с индексом из пути читателю из токена и возвращает индекс.
+// При ошибке ответ уже записан и возвращается false.
+func takeBook(w http.ResponseWriter, r *http.Request, resp Responder, db *sql.DB, Books *[]config.Book, library *Library) (int, bool) {
+	index, ok := bookIndexParam(w, r, resp)
+	if !ok {
+		return 0, false
+	}
 
-		var bookFind config.Book
-		found := false
+	userID, username, ok := actingUser(w, r, resp, db)
+	if !ok {
+		return 0, false
+	}
 
-		// Поиск книги по индексу
-		for i, book := range *Books {
-			if index == book.Index {
-				bookFind = book
-				// Удаление книги из массива
-				*Books = append((*Books)[:i], (*Books)[i+1:]...)
-				found = true
-				break
-			}
-		}
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		resp.Error(w, r, err)
+		return 0, false
+	}
+	defer tx.Rollback()
 
-		if !found {
-			http.Error(w, fmt.Sprintf("book with index %d not found", index), http.StatusNotFound)
-			return
-		}
+	if err := lendBook(r.Context(), tx, userID, index); err != nil {
+		resp.Error(w, r, err)
+		return 0, false
+	}
+	if err := tx.Commit(); err != nil {
+		resp.Error(w, r, err)
+		return 0, false
+	}
 
-		// Проверка, была ли книга успешно обновлена
-		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
-			resp.ErrorBadRequest(w, errors.New("book not found or already taken"))
-			return
-		}
+	rememberLoan(Books, library, username, index)
+	return index, true
+}
 
-		var requestBody TakeBookRequest
-		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid request body"))
-			return
+// lendBook отмечает в транзакции tx, что книга выдана читателю userID, и закрывает его бронь на нее
+func lendBook(ctx context.Context, tx *sql.Tx, userID string, index int) error {
+	// Обновление записи в таблице book
+	result, err := tx.ExecContext(ctx, "UPDATE book SET block = $1, take_count = take_count + 1 WHERE index = $2 AND block = $3 AND deleted_at IS NULL", true, index, false)
+	if err != nil {
+		return err
+	}
+
+	// Проверка, была ли книга успешно обновлена
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return problem.BadRequest(problem.CodeBookUnavailable, "book not found or already taken")
+	}
+
+	// Запись о выдаче книги читателю
+	if _, err := tx.ExecContext(ctx, "INSERT INTO loans (user_id, book_index) VALUES ($1, $2)", userID, index); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, closeHold, userID, index)
+	return err
+}
+
+// rememberLoan переносит выданную книгу из общего списка в список читателя
+func rememberLoan(Books *[]config.Book, library *Library, username string, index int) {
+	var bookFind config.Book
+
+	// Поиск книги по индексу
+	for i, book := range *Books {
+		if index == book.Index {
+			bookFind = book
+			// Удаление книги из массива
+			*Books = append((*Books)[:i], (*Books)[i+1:]...)
+			break
 		}
+	}
+
+	// Добавление книги к пользователю
+	library.Books[username] = append(library.Books[username], bookFind)
+}
+
+// bookIndexParam читает индекс книги из пути; при неверном индексе отвечает 400 и возвращает false
+func bookIndexParam(w http.ResponseWriter, r *http.Request, resp Responder) (int, bool) {
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil {
+		resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "invalid index"))
+		return 0, false
+	}
+	return index, true
+}
+
+// actingUser определяет читателя по токену запроса. Поле username в теле запроса
+// необязательно; если оно передано, то должно совпадать с владельцем токена,
+// либо у пользователя должно быть право работать с книгами за других читателей.
+func actingUser(w http.ResponseWriter, r *http.Request, resp Responder, db *sql.DB) (string, string, bool) {
+	identity, ok := service.FromContext(r.Context())
+	if !ok {
+		resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
+		return "", "", false
+	}
+
+	var requestBody TakeBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+		resp.Error(w, r, problem.BadRequest(problem.CodeInvalidRequest, "invalid request body"))
+		return "", "", false
+	}
 
-		// Проверка, был ли передан username
-		if requestBody.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+	userID, username, err := resolvePatron(r.Context(), db, identity, requestBody.Username)
+	if err != nil {
+		resp.Error(w, r, err)
+		return "", "", false
+	}
+	return userID, username, true
+}
+
+// resolvePatron возвращает id и логин читателя: владельца токена, если username пуст или совпадает с его логином,
+// иначе пользователя username — если у владельца токена есть право работать с книгами за других читателей
+func resolvePatron(ctx context.Context, db *sql.DB, identity service.Identity, username string) (string, string, error) {
+	var own string
+	err := db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = $1 AND deleted_at IS NULL", identity.UserID).Scan(&own)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", problem.Unauthorized(problem.CodeAccountDisabled, "user no longer exists")
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if username == "" || username == own {
+		return identity.UserID, own, nil
+	}
+	if !identity.Can(service.PermLoansOnBehalf) {
+		return "", "", problem.Forbidden(problem.CodeForbidden, "username does not match the authenticated user")
+	}
+
+	var patronID string
+	err = db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = $1 AND deleted_at IS NULL", username).Scan(&patronID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", problem.NotFound(problem.CodeUserNotFound, fmt.Sprintf("user %s not found", username))
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return patronID, username, nil
+}
+
+// ReturnBook принимает книгу, выданную пользователю из токена или из тела запроса
+func ReturnBook(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !returnBook(w, r, resp, db, Books, library) {
 			return
 		}
+		resp.OutputJSON(w, map[string]string{"message": "Book returned successfully"})
+	}
+}
 
-		// Добавление книги к пользователю
-		library.Books[requestBody.Username] = append(library.Books[requestBody.Username], bookFind)
-		resp.OutputJSON(w, map[string]string{"message": "Book taken successfully"})
+// returnBook принимает у читателя из токена книгу с индексом из пути.
+// При ошибке ответ уже записан и возвращается false.
+func returnBook(w http.ResponseWriter, r *http.Request, resp Responder, db *sql.DB, Books *[]config.Book, library *Library) bool {
+	index, ok := bookIndexParam(w, r, resp)
+	if !ok {
+		return false
+	}
+
+	userID, username, ok := actingUser(w, r, resp, db)
+	if !ok {
+		return false
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		resp.Error(w, r, err)
+		return false
 	}
+	defer tx.Rollback()
+
+	if err := receiveBook(r.Context(), tx, userID, index); err != nil {
+		resp.Error(w, r, err)
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		resp.Error(w, r, err)
+		return false
+	}
+
+	bookFind, err := getBookByIndex(r.Context(), db, index)
+	if err != nil {
+		resp.Error(w, r, err)
+		return false
+	}
+	forgetLoan(Books, library, username, bookFind)
+	return true
 }
 
-// @Summary Get Geo Coordinates by Address
-// @Description This endpoint allows you to get geo coordinates by address.
-// @Tags User
-// @Accept json
-// @Produce json
-// @Param index path int true "Book INDEX"
-// @Param Authorization header string true "Bearer Token"
-// @Param body body TakeBookRequest true "Request body"
-// @Success 200 {object} Response "Успешное выполнение"
-// @Failure 400 {object} mErrorResponse "Ошибка запроса"
-// @Failure 500 {object} mErrorResponse "Ошибка подключения к серверу"
-// @Security BearerAuth
-// @Router /api/book/return/{index} [delete]
-func ReturnBook(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+// receiveBook закрывает в транзакции tx выдачу книги читателю userID
+func receiveBook(ctx context.Context, tx *sql.Tx, userID string, index int) error {
+	// Закрытие записи о выдаче книги читателю
+	result, err := tx.ExecContext(ctx, "UPDATE loans SET returned_at = NOW() WHERE user_id = $1 AND book_index = $2 AND returned_at IS NULL", userID, index)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found for user", index))
+	}
+
+	// Обновление записи в таблице book
+	result, err = tx.ExecContext(ctx, "UPDATE book SET block = $1 WHERE index = $2 AND block = $3", false, index, true)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return problem.BadRequest(problem.CodeBookUnavailable, "book not found or already returned")
+	}
+	return nil
+}
+
+// forgetLoan переносит возвращенную книгу из списка читателя обратно в общий список
+func forgetLoan(Books *[]config.Book, library *Library, username string, returned config.Book) {
+	// Удаляем книгу из списка пользователя
+	userBooks := library.Books[username]
+	for i, book := range userBooks {
+		if book.Index == returned.Index {
+			library.Books[username] = append(userBooks[:i], userBooks[i+1:]...)
+			break
+		}
+	}
+
+	*Books = append(*Books, returned) // Добавляем книгу обратно в общий список
+}
+
+// UpdateBook заменяет название, автора и признак выдачи книги по индексу
+func UpdateBook(resp Responder, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			resp.Error(w, r, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method not allowed"))
+			return
+		}
+
 		indexStr := chi.URLParam(r, "index")
 		index, err := strconv.Atoi(indexStr)
 		if err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid index"))
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "invalid index"))
 			return
 		}
 
-		var requestBody TakeBookRequest
-		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid request body"))
+		var updatedBook config.Book
+		if err := validate.DecodeJSON(w, r, &updatedBook); err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		if requestBody.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+		if err := replaceBook(r.Context(), db, index, updatedBook); err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		userBooks, userExists := library.Books[requestBody.Username]
-		if !userExists {
-			http.Error(w, "User has no books", http.StatusNotFound)
+		// Возвращаем сохраненную книгу, а не тело запроса: индекс и счетчик выдач клиент не меняет
+		stored, err := getBookByIndex(r.Context(), db, index)
+		if err != nil {
+			resp.Error(w, r, err)
 			return
 		}
+		resp.OutputJSON(w, stored)
+	}
+}
 
-		found := false
-		var bookFind config.Book
+// replaceBook записывает название, автора и признак выдачи книги с индексом index
+func replaceBook(ctx context.Context, q queryer, index int, book config.Book) error {
+	// Обновление записи в таблице book
+	result, err := q.ExecContext(ctx, "UPDATE book SET book = $1, author = $2, block = $3 WHERE index = $4 AND deleted_at IS NULL",
+		book.Book, book.Author, book.Block, index)
+	if err != nil {
+		return err
+	}
 
-		// Поиск книги у пользователя
-		for i, book := range userBooks {
-			if book.Index == index {
-				bookFind = book
-				library.Books[requestBody.Username] = append(userBooks[:i], userBooks[i+1:]...) // Удаляем книгу из списка пользователя
-				found = true
-				break
-			}
-		}
+	// Проверка, была ли книга успешно обновлена
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found", index))
+	}
+	return nil
+}
 
-		if !found {
-			http.Error(w, fmt.Sprintf("book with index %d not found for user", index), http.StatusNotFound)
+// PatchBook меняет только переданные поля книги: JSON Merge Patch (application/merge-patch+json)
+// или JSON Patch (application/json-patch+json)
+func PatchBook(resp Responder, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		indexStr := chi.URLParam(r, "index")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil {
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "invalid index"))
 			return
 		}
 
-		// Обновление записи в таблице book
-		result, err := db.Exec("UPDATE book SET block = $1 WHERE index = $2 AND block = $3", false, index, true)
+		patchBody, err := io.ReadAll(r.Body)
 		if err != nil {
-			resp.ErrorInternal(w, err)
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidRequest, "invalid request body"))
 			return
 		}
-		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
-			resp.ErrorBadRequest(w, errors.New("book not found or already returned"))
+
+		current, err := getBookByIndex(r.Context(), db, index)
+		if errors.Is(err, sql.ErrNoRows) {
+			resp.Error(w, r, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found", index)))
 			return
 		}
-
-		// Добавление книги обратно в общий список книг
-		*Books = append(*Books, bookFind) // Добавляем книгу обратно в общий список
-		resp.OutputJSON(w, map[string]string{"message": "Book returned successfully"})
-	}
-}
-
-// @Summary Обновление информации о книге
-// @Description Этот эндпоинт позволяет обновить информацию о книге по индексу.
-// @Tags Books
-// @Accept json
-// @Produce json
-// @Param index path int true "Индекс книги"
-// @Param Authorization header string true "Bearer Token"
-// @Param body body models.Book true "Обновленная информация о книге"
-// @Success 200 {object} models.Book "Успешное обновление книги"
-// @Failure 400 {object} mErrorResponse "Ошибка запроса"
-// @Failure 404 {object} mErrorResponse "Книга не найдена"
-// @Failure 500 {object} mErrorResponse "Ошибка сервера"
-// @Router /api/book/{index} [put]
-func UpdateBook(resp Responder, db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPut {
-			http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		if err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		indexStr := chi.URLParam(r, "index")
-		index, err := strconv.Atoi(indexStr)
+		doc, err := json.Marshal(current)
 		if err != nil {
-			resp.ErrorBadRequest(w, errors.New("недопустимый индекс"))
+			resp.Error(w, r, err)
+			return
+		}
+
+		patched, err := patch.Apply(r.Header.Get("Content-Type"), doc, patchBody)
+		switch {
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			resp.Error(w, r, problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, err.Error()))
+			return
+		case errors.Is(err, patch.ErrTestFailed):
+			resp.Error(w, r, problem.Conflict(problem.CodePatchTestFailed, err.Error()))
+			return
+		case err != nil:
+			resp.Error(w, r, problem.BadRequest(problem.CodeInvalidRequest, err.Error()))
 			return
 		}
 
 		var updatedBook config.Book
-		if err := json.NewDecoder(r.Body).Decode(&updatedBook); err != nil {
-			resp.ErrorBadRequest(w, errors.New("недопустимый формат данных"))
+		if err := validate.Unmarshal(patched, &updatedBook); err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		// Обновление записи в таблице book
-		result, err := db.Exec("UPDATE book SET book = $1, author = $2, block = $3 WHERE index = $4",
-			updatedBook.Book, updatedBook.Author, updatedBook.Block, index)
-		if err != nil {
-			resp.ErrorInternal(w, err)
+		// Индекс, счетчик выдач и отметка об удалении изменяются только сервером
+		if updatedBook.Index != current.Index || updatedBook.TakeCount != current.TakeCount || updatedBook.DeletedAt != nil {
+			resp.Error(w, r, problem.BadRequest(problem.CodeReadOnlyField, "index, take_count and deleted_at are read-only"))
+			return
+		}
+		if err := validate.Struct(updatedBook); err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		// Проверка, была ли книга успешно обновлена
-		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
-			resp.ErrorBadRequest(w, errors.New("книга не найдена или не обновлена"))
+		_, err = db.ExecContext(r.Context(), "UPDATE book SET book = $1, author = $2, block = $3 WHERE index = $4 AND deleted_at IS NULL",
+			updatedBook.Book, updatedBook.Author, updatedBook.Block, index)
+		if err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
-		// Возвращаем обновленную книгу
 		resp.OutputJSON(w, updatedBook)
 	}
 }
 
+// queryer — *sql.DB или *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getBookByIndex читает книгу из базы данных по индексу
+func getBookByIndex(ctx context.Context, q queryer, index int) (config.Book, error) {
+	var book config.Book
+	err := q.QueryRowContext(ctx, "SELECT index, book, author, block, take_count FROM book WHERE index = $1 AND deleted_at IS NULL", index).
+		Scan(&book.Index, &book.Book, &book.Author, &book.Block, &book.TakeCount)
+	return book, err
+}
+
 func ListAuthorsHandler(resp Responder, library *Library) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		library.mu.RLock()         // Блокируем чтение
@@ -404,94 +577,76 @@ func ListAuthorsHandler(resp Responder, library *Library) http.HandlerFunc {
 		}
 
 		// Преобразуем множество в срез
-		var authors []string
+		authors := []string{} // Без книг — [], а не null
 		for author := range authorsSet {
 			authors = append(authors, author)
 		}
 
-		resp.OutputJSON(w, authors) // Возвращаем список авторов в формате JSON
+		resp.Negotiate(w, r, authors) // Возвращаем список авторов в формате из Accept
 	}
 }
 
-// @Summary Add a new book to the library
-// @Description This endpoint allows you to add a new book to the library.
-// @Tags Books
-// @Accept json
-// @Produce json
-// @Param book body repository.AddaderBook false "Book details"
-// @Success 201 {object} models.Book "Book added successfully"
-// @Failure 400 {object} mErrorResponse "Invalid request"
-// @Failure 500 {object} mErrorResponse "Internal server error"
-// @Router /api/book [post]
+// AddBookHandler добавляет книгу в библиотеку
 func AddBookHandler(resp Responder, db *sql.DB, library *Library, Books *[]config.Book) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var addaderBook models.AddaderBook
-		if err := json.NewDecoder(r.Body).Decode(&addaderBook); err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid request body"))
-			return
-		}
-
-		// Проверка на существование книги
-		var exists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM book WHERE book = $1 AND author = $2)", addaderBook.Book, addaderBook.Author).Scan(&exists)
-		if err != nil {
-			resp.ErrorInternal(w, err)
-			return
-		}
-		if exists {
-			resp.ErrorBadRequest(w, errors.New("book already exists"))
+		newBook, ok := addBook(w, r, resp, db, library, Books)
+		if !ok {
 			return
 		}
+		resp.OutputJSON(w, newBook) // Возвращаем добавленную книгу
+	}
+}
 
-		var newBook config.Book
-		newBook.Book = addaderBook.Book
-		newBook.Author = addaderBook.Author
+// addBook добавляет книгу из тела запроса в каталог. При ошибке ответ уже записан и возвращается false.
+func addBook(w http.ResponseWriter, r *http.Request, resp Responder, db *sql.DB, library *Library, Books *[]config.Book) (config.Book, bool) {
+	var addaderBook models.AddaderBook
+	if err := validate.DecodeJSON(w, r, &addaderBook); err != nil {
+		resp.Error(w, r, err)
+		return config.Book{}, false
+	}
 
-		bloc := false
-		newBook.Block = &bloc
+	var newBook config.Book
+	newBook.Book = addaderBook.Book
+	newBook.Author = addaderBook.Author
 
-		// Вставка новой книги в базу данных
-		_, err = db.Exec("INSERT INTO book (book, author, block) VALUES ($1, $2, $3)", newBook.Book, newBook.Author, newBook.Block)
-		if err != nil {
-			resp.ErrorInternal(w, err)
-			return
-		}
-		bookPtr := &Books
+	bloc := false
+	newBook.Block = &bloc
 
-		// Получаем последний элемент
-		lastElement := (**bookPtr)[len(**bookPtr)-1].Index
-		newBook.Index = lastElement + 1
+	// Проверка на существование книги
+	var exists bool
+	err := db.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM book WHERE book = $1 AND author = $2 AND deleted_at IS NULL)", addaderBook.Book, addaderBook.Author).Scan(&exists)
+	if err != nil {
+		resp.Error(w, r, err)
+		return config.Book{}, false
+	}
+	if exists {
+		resp.Error(w, r, problem.BadRequest(problem.CodeAlreadyExists, "book already exists"))
+		return config.Book{}, false
+	}
 
-		library.AddBook(newBook)
-		*Books = append(*Books, newBook)
-		resp.OutputJSON(w, newBook) // Возвращаем добавленную книгу
+	// Вставка новой книги в базу данных; индекс назначает база
+	err = db.QueryRowContext(r.Context(), "INSERT INTO book (book, author, block) VALUES ($1, $2, $3) RETURNING index",
+		newBook.Book, newBook.Author, newBook.Block).Scan(&newBook.Index)
+	if err != nil {
+		resp.Error(w, r, err)
+		return config.Book{}, false
 	}
+
+	library.AddBook(newBook)
+	*Books = append(*Books, newBook)
+	return newBook, true
 }
 
 type AuthorRequest struct {
-	Name string `json:"name"`
-}
-
-// @Summary Add a new author to the library
-// @Description This endpoint allows you to add a new author to the library.
-// @Tags Authors
-// @Accept json
-// @Produce json
-// @Param author body AuthorRequest true "Author name"
-// @Success 201 {object} string "Author added successfully"
-// @Failure 400 {object} mErrorResponse "Invalid request"
-// @Failure 500 {object} mErrorResponse "Internal server error"
-// @Router /api/authors [post]
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+// AddAuthorHandler добавляет автора в библиотеку
 func AddAuthorHandler(resp Responder, library *Library) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var authorRequest AuthorRequest
-		if err := json.NewDecoder(r.Body).Decode(&authorRequest); err != nil {
-			resp.ErrorBadRequest(w, errors.New("invalid request body"))
-			return
-		}
-
-		if authorRequest.Name == "" {
-			resp.ErrorBadRequest(w, errors.New("author name is required"))
+		if err := validate.DecodeJSON(w, r, &authorRequest); err != nil {
+			resp.Error(w, r, err)
 			return
 		}
 
@@ -506,14 +661,7 @@ func AddAuthorHandler(resp Responder, library *Library) http.HandlerFunc {
 	}
 }
 
-// getAuthorsHandler godoc
-// @Summary Get all authors
-// @Description Get a list of all authors in the library
-// @Tags Authors
-// @Produce json
-// @Success 200 {array} string "List of authors"
-// @Failure 404 {object} mErrorResponse "No authors found"
-// @Router /api/get-authors [get]
+// GetAuthorsHandler возвращает всех авторов библиотеки
 func GetAuthorsHandler(resp Responder, library *Library) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		library.mu.RLock()         // Блокируем чтение
@@ -521,11 +669,11 @@ func GetAuthorsHandler(resp Responder, library *Library) http.HandlerFunc {
 
 		// Проверяем, есть ли авторы
 		if len(library.Authors) == 0 {
-			http.Error(w, "No authors found", http.StatusNotFound)
+			resp.Error(w, r, problem.NotFound(problem.CodeNotFound, "no authors found"))
 			return
 		}
 
-		// Возвращаем список авторов в формате JSON
-		resp.OutputJSON(w, library.Authors)
+		// Возвращаем список авторов в формате из Accept
+		resp.Negotiate(w, r, library.Authors)
 	}
 }
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// closeHold закрывает действующую бронь читателя на книгу: при отмене и при выдаче книги по брони
+const closeHold = "UPDATE holds SET closed_at = NOW() WHERE user_id = $1 AND book_index = $2 AND closed_at IS NULL"
+
+// CreateHold ставит читателя из токена в очередь на книгу, а библиотекарь может поставить читателя из
+// тела запроса. У читателя может быть одна действующая бронь на книгу, повторная бронь — 409.
+// Бронь закрывается, когда читатель берет книгу, и не дает другим читателям продлить ее выдачу.
+func CreateHold(resp Responder, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, ok := bookIndexParam(w, r, resp)
+		if !ok {
+			return
+		}
+		userID, username, ok := actingUser(w, r, resp, db)
+		if !ok {
+			return
+		}
+
+		hold, err := placeHold(r.Context(), db, userID, index)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		hold.Username = username
+		resp.Created(w, fmt.Sprintf("/api/v2/books/%d/hold", index), hold)
+	}
+}
+
+// placeHold добавляет бронь читателя userID в конец очереди на книгу и возвращает ее с местом в очереди
+func placeHold(ctx context.Context, db *sql.DB, userID string, index int) (models.Hold, error) {
+	book, err := getBookByIndex(ctx, db, index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Hold{}, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found", index))
+	}
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	hold := models.Hold{BookIndex: index, Book: book.Book}
+	if hold.UserID, err = strconv.Atoi(userID); err != nil {
+		return models.Hold{}, err
+	}
+	// Уникальный индекс по действующим броням не дает одновременным запросам поставить читателя в очередь дважды
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO holds (user_id, book_index) VALUES ($1, $2)
+		ON CONFLICT (user_id, book_index) WHERE closed_at IS NULL DO NOTHING
+		RETURNING id, created_at`, userID, index).Scan(&hold.ID, &hold.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Hold{}, problem.Conflict(problem.CodeHoldExists, "book is already on hold for the user")
+	}
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM holds
+		WHERE book_index = $1 AND closed_at IS NULL AND (created_at, id) <= ($2, $3)`,
+		index, hold.CreatedAt, hold.ID).Scan(&hold.Position)
+	return hold, err
+}
+
+// DeleteHold отменяет бронь читателя из токена, а библиотекарь может отменить бронь читателя из тела запроса
+func DeleteHold(resp Responder, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, ok := bookIndexParam(w, r, resp)
+		if !ok {
+			return
+		}
+		userID, _, ok := actingUser(w, r, resp, db)
+		if !ok {
+			return
+		}
+
+		result, err := db.ExecContext(r.Context(), closeHold, userID, index)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		if rowsAffected == 0 {
+			resp.Error(w, r, problem.NotFound(problem.CodeHoldNotFound, fmt.Sprintf("no hold on book with index %d for user", index)))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
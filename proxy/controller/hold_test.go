@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+func TestHolds(t *testing.T) {
+	db := newLibraryDB()
+	books := []config.Book{}
+	resp := NewResponder(zap.NewNop())
+	r := chi.NewRouter()
+	r.Post("/books/{index}/hold", CreateHold(resp, sql.OpenDB(db)))
+	r.Delete("/books/{index}/hold", DeleteHold(resp, sql.OpenDB(db)))
+	r.Post("/books/{index}/loan", CreateLoan(resp, sql.OpenDB(db), &books, NewLibrary()))
+	serve := func(method, target, body string, identity service.Identity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(service.NewContext(req.Context(), identity))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	other := service.Identity{UserID: "8", Username: "other", Role: "patron"}
+
+	rr := serve(http.MethodPost, "/books/4/hold", "", other)
+	var hold models.Hold
+	if rr.Code != http.StatusCreated || json.Unmarshal(rr.Body.Bytes(), &hold) != nil {
+		t.Fatalf("Expected 201 with the hold, got %d: %s", rr.Code, rr.Body)
+	}
+	if hold.UserID != 8 || hold.Username != "other" || hold.Book != "Ubik" || hold.Position != 1 {
+		t.Errorf("Unexpected hold %+v", hold)
+	}
+	if rr = serve(http.MethodPost, "/books/4/hold", "", other); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a second hold, got %d", rr.Code)
+	}
+	if rr = serve(http.MethodPost, "/books/9/hold", "", other); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing book, got %d", rr.Code)
+	}
+
+	// Библиотекарь ставит в очередь другого читателя; бронь закрывается, когда читатель берет книгу
+	rr = serve(http.MethodPost, "/books/1/hold", `{"username":"reader"}`, service.Identity{UserID: "8", Username: "other", Role: "librarian"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a hold on behalf, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr = serve(http.MethodPost, "/books/1/loan", "", patron); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a loan, got %d: %s", rr.Code, rr.Body)
+	}
+	if db.state.holding("7", 1) {
+		t.Error("Expected the hold to be closed by the loan")
+	}
+
+	if rr = serve(http.MethodDelete, "/books/4/hold", "", other); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for a cancelled hold, got %d", rr.Code)
+	}
+	if rr = serve(http.MethodDelete, "/books/4/hold", "", other); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a hold, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// LoanRenewal — выдача после продления
+type LoanRenewal struct {
+	BookIndex int       `json:"book_index"`
+	DueAt     time.Time `json:"due_at"`   // Новый срок возврата
+	Renewals  int       `json:"renewals"` // Сколько раз выдача продлена
+}
+
+// RenewLoan продлевает выдачу книги читателю из токена на rules.Period, а библиотекарь может продлить выдачу
+// читателю из тела запроса. Книгу, которую ждут по брони другие читатели, и выдачу, продленную
+// rules.MaxRenewals раз, продлить нельзя — 409.
+func RenewLoan(resp Responder, db *sql.DB, rules config.LoanConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, ok := bookIndexParam(w, r, resp)
+		if !ok {
+			return
+		}
+		userID, _, ok := actingUser(w, r, resp, db)
+		if !ok {
+			return
+		}
+
+		renewal, err := renewLoan(r.Context(), db, userID, index, rules)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		resp.OutputJSON(w, renewal)
+	}
+}
+
+// renewLoan переносит срок возврата книги читателем userID. Срок считается от прежнего срока возврата,
+// у просроченной выдачи — от текущего момента; выдача без срока возвращается через rules.Period после выдачи.
+func renewLoan(ctx context.Context, db *sql.DB, userID string, index int, rules config.LoanConfig) (LoanRenewal, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return LoanRenewal{}, err
+	}
+	defer tx.Rollback()
+
+	var loanID, renewals int
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, renewals FROM loans WHERE user_id = $1 AND book_index = $2 AND returned_at IS NULL FOR UPDATE",
+		userID, index).Scan(&loanID, &renewals)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoanRenewal{}, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found for user", index))
+	}
+	if err != nil {
+		return LoanRenewal{}, err
+	}
+	if renewals >= rules.MaxRenewals {
+		return LoanRenewal{}, problem.Conflict(problem.CodeRenewalLimit, fmt.Sprintf("loan has already been renewed %d times", renewals))
+	}
+
+	var onHold bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM holds WHERE book_index = $1 AND user_id <> $2 AND closed_at IS NULL)",
+		index, userID).Scan(&onHold)
+	if err != nil {
+		return LoanRenewal{}, err
+	}
+	if onHold {
+		return LoanRenewal{}, problem.Conflict(problem.CodeBookOnHold, "book is on hold for other patrons")
+	}
+
+	renewal := LoanRenewal{BookIndex: index}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE loans SET
+			due_at = GREATEST(COALESCE(due_at, taken_at + $2 * INTERVAL '1 second'), NOW()) + $2 * INTERVAL '1 second',
+			renewals = renewals + 1
+		WHERE id = $1
+		RETURNING due_at, renewals`, loanID, rules.Period.Seconds()).Scan(&renewal.DueAt, &renewal.Renewals)
+	if err != nil {
+		return LoanRenewal{}, err
+	}
+	return renewal, tx.Commit()
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+)
+
+// Обработчики /api/v2. Ресурсы в v2 всегда отдаются одним документом: список — массивом (пустой — []),
+// созданный ресурс — с 201 и заголовком Location, удаление связи — 204 без тела.
+
+// ListBooks возвращает каталог. fields= оставляет перечисленные поля книги, include= встраивает authors,
+// current_loan и holds; каждая связь загружается одним запросом на весь список. current_loan и holds
+// содержат данные читателей и доступны только с правом loans:on_behalf.
+func ListBooks(resp Responder, db *sql.DB, relations BookRelations) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sel, err := bookSelection(r)
+		if err == nil {
+			err = authorizeRelations(r.Context(), sel)
+		}
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), "SELECT index, book, author, block, take_count FROM book WHERE deleted_at IS NULL ORDER BY index")
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		books := []config.Book{}
+		for rows.Next() {
+			var book config.Book
+			if err := rows.Scan(&book.Index, &book.Book, &book.Author, &book.Block, &book.TakeCount); err != nil {
+				resp.Error(w, r, err)
+				return
+			}
+			books = append(books, book)
+		}
+		if err := rows.Err(); err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		rows.Close() // Соединение нужно запросам связей
+
+		views, err := embedBooks(r.Context(), db, relations, books, sel)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		body, err := sel.Apply(views)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		resp.Negotiate(w, r, body)
+	}
+}
+
+// GetBook возвращает книгу; fields=, include= и формат ответа по Accept — как в ListBooks
+func GetBook(resp Responder, db *sql.DB, relations BookRelations) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, ok := bookIndexParam(w, r, resp)
+		if !ok {
+			return
+		}
+		sel, err := bookSelection(r)
+		if err == nil {
+			err = authorizeRelations(r.Context(), sel)
+		}
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		book, err := getBookByIndex(r.Context(), db, index)
+		if errors.Is(err, sql.ErrNoRows) {
+			resp.Error(w, r, problem.NotFound(problem.CodeBookNotFound, fmt.Sprintf("book with index %d not found", index)))
+			return
+		}
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+
+		views, err := embedBooks(r.Context(), db, relations, []config.Book{book}, sel)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		body, err := sel.Apply(views[0])
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		resp.Negotiate(w, r, body)
+	}
+}
+
+func CreateBook(resp Responder, db *sql.DB, library *Library, Books *[]config.Book) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		book, ok := addBook(w, r, resp, db, library, Books)
+		if !ok {
+			return
+		}
+		resp.Created(w, "/api/v2/books/"+strconv.Itoa(book.Index), book)
+	}
+}
+
+// CreateLoan выдает книгу пользователю из токена, а библиотекарь может выдать ее пользователю из тела запроса
+func CreateLoan(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, ok := takeBook(w, r, resp, db, Books, library)
+		if !ok {
+			return
+		}
+		book, err := getBookByIndex(r.Context(), db, index)
+		if err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+		resp.Created(w, fmt.Sprintf("/api/v2/books/%d/loan", index), book)
+	}
+}
+
+func DeleteLoan(resp Responder, db *sql.DB, Books *[]config.Book, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !returnBook(w, r, resp, db, Books, library) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListAuthors(resp Responder, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		library.mu.RLock()
+		authors := append([]string{}, library.Authors...)
+		library.mu.RUnlock()
+
+		resp.Negotiate(w, r, authors)
+	}
+}
+
+func CreateAuthor(resp Responder, library *Library) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var author AuthorRequest
+		if err := validate.DecodeJSON(w, r, &author); err != nil {
+			resp.Error(w, r, err)
+			return
+		}
+
+		library.mu.Lock()
+		if !contains(library.Authors, author.Name) {
+			library.Authors = append(library.Authors, author.Name)
+		}
+		library.mu.Unlock()
+
+		resp.Created(w, "/api/v2/authors", author)
+	}
+}
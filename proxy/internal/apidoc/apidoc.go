@@ -0,0 +1,318 @@
+// Package apidoc строит OpenAPI 3.1 документ из описаний маршрутов. Схемы тел запросов и ответов
+// выводятся из Go типов, которые читают и пишут обработчики, поэтому документ не расходится с кодом.
+// Missing сверяет описания с маршрутами chi роутера: маршрут без описания считается ошибкой.
+package apidoc
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+const openAPIVersion = "3.1.0"
+
+// Route описывает одну операцию API
+type Route struct {
+	Method  string
+	Path    string // Шаблон chi относительно префикса версии, например /books/{index}
+	Summary string
+	Tag     string
+	Auth    bool    // Нужен Bearer токен или API ключ; 401 добавляется автоматически
+	Query   []Param // Параметры строки запроса; параметры пути берутся из Path
+	Headers []Param // Заголовки запроса
+
+	Request      interface{} // Значение типа JSON тела запроса, например models.User{}, или Content; nil — тела нет
+	OptionalBody bool        // Тело запроса можно не передавать
+	OptionalAuth bool        // Токен или API ключ можно не передавать, с ними ответ полнее; 401 добавляется автоматически
+
+	Status   int         // Статус успешного ответа, по умолчанию 200
+	Response interface{} // Значение типа тела ответа или OneOf(...); nil — ответ без тела
+	Produces []string    // Форматы успешного ответа по Accept, если их несколько; по умолчанию только JSON
+	Sparse   bool        // Поля ответа выбираются параметром fields=, поэтому ни одно не обязательно
+	Errors   []int       // Статусы ответов application/problem+json
+
+	Deprecated bool
+}
+
+// Param — параметр строки запроса или заголовок
+type Param struct {
+	Name        string
+	Type        string // string, integer, boolean
+	Description string
+	Required    bool
+}
+
+// Content сопоставляет типы содержимого с типами тела, если операция принимает несколько форматов
+type Content map[string]interface{}
+
+type oneOf []interface{}
+
+// OneOf описывает ответ, тело которого может быть одним из нескольких типов
+func OneOf(bodies ...interface{}) interface{} {
+	return oneOf(bodies)
+}
+
+// Info описывает версию API в документе
+type Info struct {
+	Title          string
+	Version        string // Например v1
+	Description    string
+	BasePath       string            // Префикс, под которым смонтирован роутер, например /api/v1; пусто — корень
+	PathParamTypes map[string]string // Типы параметров пути по имени, по умолчанию string
+}
+
+// Document — корень OpenAPI документа
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       DocumentInfo                    `json:"info"`
+	Servers    []Server                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type DocumentInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// Build описывает операции версии API
+func Build(info Info, routes []Route) Document {
+	schemas := newSchemaSet()
+	doc := Document{
+		OpenAPI: openAPIVersion,
+		Info:    DocumentInfo{Title: info.Title, Version: info.Version},
+		Servers: []Server{{URL: info.BasePath}},
+		Paths:   make(map[string]map[string]Operation),
+		Components: Components{
+			Schemas: schemas.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				"BearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT or API key"},
+				"ApiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	if info.BasePath != "" {
+		doc.Servers = []Server{{URL: info.BasePath}}
+	}
+	problemSchema := schemas.of(problem.Problem{})
+
+	for _, route := range routes {
+		path := openAPIPath(route.Path)
+		method := strings.ToLower(route.Method)
+		op := Operation{
+			OperationID: operationID(method, path),
+			Summary:     route.Summary,
+			Deprecated:  route.Deprecated,
+			Responses:   make(map[string]Response),
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+			typ := info.PathParamTypes[match[1]]
+			if typ == "" {
+				typ = "string"
+			}
+			op.Parameters = append(op.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: Schema{Type: typ}})
+		}
+		for _, param := range route.Query {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: param.Name, In: "query", Description: param.Description, Required: param.Required,
+				Schema: Schema{Type: param.Type},
+			})
+		}
+		for _, param := range route.Headers {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: param.Name, In: "header", Description: param.Description, Required: param.Required,
+				Schema: Schema{Type: param.Type},
+			})
+		}
+
+		if route.Request != nil {
+			bodies, ok := route.Request.(Content)
+			if !ok {
+				bodies = Content{"application/json": route.Request}
+			}
+			op.RequestBody = &RequestBody{Required: !route.OptionalBody, Content: make(map[string]MediaType)}
+			for contentType, body := range bodies {
+				op.RequestBody.Content[contentType] = MediaType{Schema: schemas.of(body)}
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := Response{Description: http.StatusText(status)}
+		if bodies, ok := route.Response.(oneOf); ok {
+			alternatives := make([]Schema, 0, len(bodies))
+			for _, body := range bodies {
+				alternatives = append(alternatives, schemas.of(body))
+			}
+			success.Content = map[string]MediaType{"application/json": {Schema: Schema{OneOf: alternatives}}}
+		} else if route.Response != nil {
+			schema := schemas.of(route.Response)
+			if route.Sparse {
+				schemas.optional(schema)
+			}
+			success.Content = map[string]MediaType{"application/json": {Schema: schema}}
+			for _, contentType := range route.Produces {
+				if contentType == "text/csv" {
+					success.Content[contentType] = MediaType{Schema: Schema{Type: "string"}}
+				} else {
+					success.Content[contentType] = MediaType{Schema: schema}
+				}
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		failures := route.Errors
+		if route.Auth || route.OptionalAuth {
+			op.Security = []map[string][]string{{"BearerAuth": {}}, {"ApiKeyAuth": {}}}
+			failures = append([]int{http.StatusUnauthorized}, failures...)
+		}
+		if route.OptionalAuth {
+			op.Security = append([]map[string][]string{{}}, op.Security...) // Пустое требование — можно без входа
+		}
+		for _, code := range failures {
+			op.Responses[strconv.Itoa(code)] = Response{
+				Description: http.StatusText(code),
+				Content:     map[string]MediaType{problem.ContentType: {Schema: problemSchema}},
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]Operation)
+		}
+		doc.Paths[path][method] = op
+	}
+	return doc
+}
+
+// Prefix возвращает копии описаний с путями под префиксом, например для роутера, смонтированного в /api/v1
+func Prefix(prefix string, routes []Route) []Route {
+	prefixed := make([]Route, len(routes))
+	for i, route := range routes {
+		route.Path = prefix + route.Path
+		prefixed[i] = route
+	}
+	return prefixed
+}
+
+// Missing возвращает маршруты роутера, для которых нет описания, и описания без маршрута,
+// в виде "METHOD /path". Пустой результат означает, что документ полон.
+func Missing(router chi.Routes, routes []Route) (undocumented, unrouted []string, err error) {
+	described := make(map[string]bool)
+	for _, route := range routes {
+		described[strings.ToUpper(route.Method)+" "+openAPIPath(route.Path)] = true
+	}
+	registered := make(map[string]bool)
+	err = chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		key := method + " " + openAPIPath(route)
+		registered[key] = true
+		if !described[key] {
+			undocumented = append(undocumented, key)
+		}
+		return nil
+	})
+	for key := range described {
+		if !registered[key] {
+			unrouted = append(unrouted, key)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	return undocumented, unrouted, err
+}
+
+// openAPIPath приводит шаблон chi к виду OpenAPI: без регулярных выражений параметров и завершающего слэша
+func openAPIPath(route string) string {
+	route = pathParam.ReplaceAllString(route, "{$1}")
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	return route
+}
+
+// operationID строит стабильный идентификатор вида post_books_index_loan
+func operationID(method, path string) string {
+	var parts []string
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(segment, "{}")
+		if segment != "" {
+			parts = append(parts, strings.NewReplacer("-", "_", ".", "_").Replace(segment))
+		}
+	}
+	return strings.ToLower(method) + "_" + strings.Join(parts, "_")
+}
+
+// Handler отдает документ в JSON; документ сериализуется один раз
+func Handler(doc Document) http.HandlerFunc {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		panic("apidoc: " + err.Error())
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,105 @@
+package apidoc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type testBook struct {
+	Index     int        `json:"index"`
+	Title     string     `json:"title" validate:"required,max=50"`
+	Email     string     `json:"email,omitempty" validate:"email"`
+	Role      string     `json:"role" validate:"oneof=patron admin"`
+	Block     *bool      `json:"block" validate:"required"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Secret    string     `json:"-"`
+	Tags      []string   `json:"tags"`
+}
+
+func TestBuildDerivesSchemasFromTypes(t *testing.T) {
+	doc := Build(Info{Title: "Library API", Version: "v2", BasePath: "/api/v2", PathParamTypes: map[string]string{"index": "integer"}},
+		[]Route{{
+			Method: http.MethodPut, Path: "/books/{index}", Auth: true,
+			Request: testBook{}, Response: testBook{}, Errors: []int{http.StatusNotFound},
+		}})
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	op, ok := doc.Paths["/books/{index}"]["put"]
+	if !ok {
+		t.Fatalf("operation is missing: %+v", doc.Paths)
+	}
+	if op.OperationID != "put_books_index" {
+		t.Errorf("operationId = %q", op.OperationID)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Schema.Type != "integer" {
+		t.Errorf("parameters = %+v", op.Parameters)
+	}
+	for _, status := range []string{"200", "401", "404"} {
+		if _, ok := op.Responses[status]; !ok {
+			t.Errorf("response %s is missing", status)
+		}
+	}
+	if ref := op.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/apidoc.testBook" {
+		t.Errorf("request schema ref = %q", ref)
+	}
+	if ref := op.Responses["404"].Content["application/problem+json"].Schema.Ref; ref != "#/components/schemas/problem.Problem" {
+		t.Errorf("error schema ref = %q", ref)
+	}
+
+	book := doc.Components.Schemas["apidoc.testBook"]
+	if !reflect.DeepEqual(book.Required, []string{"title", "block"}) {
+		t.Errorf("required = %v", book.Required)
+	}
+	if title := book.Properties["title"]; title.Type != "string" || title.MaxLength == nil || *title.MaxLength != 50 {
+		t.Errorf("title = %+v", title)
+	}
+	if email := book.Properties["email"]; email.Format != "email" {
+		t.Errorf("email = %+v", email)
+	}
+	if role := book.Properties["role"]; !reflect.DeepEqual(role.Enum, []string{"patron", "admin"}) {
+		t.Errorf("role = %+v", role)
+	}
+	if block := book.Properties["block"]; !reflect.DeepEqual(block.Type, []string{"boolean", "null"}) {
+		t.Errorf("block = %+v", block)
+	}
+	if deleted := book.Properties["deleted_at"]; !reflect.DeepEqual(deleted.Type, []string{"string", "null"}) || deleted.Format != "date-time" {
+		t.Errorf("deleted_at = %+v", deleted)
+	}
+	if tags := book.Properties["tags"]; !reflect.DeepEqual(tags.Type, []string{"array", "null"}) || tags.Items == nil || tags.Items.Type != "string" {
+		t.Errorf("tags = %+v", tags)
+	}
+	if _, ok := book.Properties["Secret"]; ok {
+		t.Error(`fields tagged json:"-" must be skipped`)
+	}
+}
+
+func TestMissingReportsUndocumentedAndUnroutedOperations(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	r := chi.NewRouter()
+	r.Get("/books", noop)
+	r.Route("/users/{id}/sessions", func(r chi.Router) {
+		r.Get("/", noop)
+		r.Delete("/{sessionID}", noop)
+	})
+
+	undocumented, unrouted, err := Missing(r, []Route{
+		{Method: http.MethodGet, Path: "/books"},
+		{Method: http.MethodGet, Path: "/users/{id}/sessions"},
+		{Method: http.MethodPost, Path: "/books"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(undocumented, []string{"DELETE /users/{id}/sessions/{sessionID}"}) {
+		t.Errorf("undocumented = %v", undocumented)
+	}
+	if !reflect.DeepEqual(unrouted, []string{"POST /books"}) {
+		t.Errorf("unrouted = %v", unrouted)
+	}
+}
@@ -0,0 +1,227 @@
+package apidoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+const refPrefix = "#/components/schemas/"
+
+// Проверяется подмножество JSON Schema, которое порождает schemaSet: type, properties, required, items,
+// additionalProperties, enum, pattern, ограничения длины и значения, anyOf и oneOf. format — только
+// аннотация, как и положено в JSON Schema 2020-12. oneOf проверяется как anyOf: структуры ответов
+// без обязательных полей подходят под несколько вариантов сразу.
+
+var patterns sync.Map // Скомпилированные Schema.Pattern
+
+// checkValue сверяет значение, разобранное decodeJSON, со схемой и дописывает нарушения в out.
+// at — путь к значению через точку, пустой для корня документа.
+func (doc *Document) checkValue(schema Schema, value interface{}, at string, out *[]problem.FieldError) {
+	if schema.Ref != "" {
+		resolved, ok := doc.Components.Schemas[strings.TrimPrefix(schema.Ref, refPrefix)]
+		if !ok {
+			*out = append(*out, problem.Field(fieldName(at), "undocumented", "schema "+schema.Ref+" is not defined"))
+			return
+		}
+		doc.checkValue(resolved, value, at, out)
+		return
+	}
+	if alternatives := append(append([]Schema{}, schema.AnyOf...), schema.OneOf...); len(alternatives) > 0 {
+		doc.checkAlternatives(alternatives, value, at, out)
+		return
+	}
+
+	if !hasType(schema.Type, value) {
+		*out = append(*out, problem.Field(fieldName(at), "type", fmt.Sprintf("%s must be %s", fieldName(at), typeList(schema.Type))))
+		return
+	}
+
+	switch value := value.(type) {
+	case string:
+		doc.checkString(schema, value, at, out)
+	case json.Number:
+		checkNumber(schema, value, at, out)
+	case []interface{}:
+		if schema.MinItems != nil && len(value) < *schema.MinItems {
+			*out = append(*out, problem.Field(fieldName(at), "too_short", fmt.Sprintf("%s must have at least %d items", fieldName(at), *schema.MinItems)))
+		}
+		if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+			*out = append(*out, problem.Field(fieldName(at), "too_long", fmt.Sprintf("%s must have at most %d items", fieldName(at), *schema.MaxItems)))
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				doc.checkValue(*schema.Items, item, join(at, strconv.Itoa(i)), out)
+			}
+		}
+	case map[string]interface{}:
+		doc.checkObject(schema, value, at, out)
+	}
+}
+
+// checkAlternatives принимает значение, подходящее хотя бы под одну из схем. Если кроме null вариант
+// один, сообщаются его нарушения: так ошибка в поле указателя на структуру видна по полям.
+func (doc *Document) checkAlternatives(alternatives []Schema, value interface{}, at string, out *[]problem.FieldError) {
+	var candidates []Schema
+	for _, alternative := range alternatives {
+		var violations []problem.FieldError
+		doc.checkValue(alternative, value, at, &violations)
+		if len(violations) == 0 {
+			return
+		}
+		if alternative.Type != "null" {
+			candidates = append(candidates, alternative)
+		}
+	}
+	if len(candidates) == 1 {
+		doc.checkValue(candidates[0], value, at, out)
+		return
+	}
+	*out = append(*out, problem.Field(fieldName(at), "invalid", fieldName(at)+" does not match any of the allowed schemas"))
+}
+
+func (doc *Document) checkString(schema Schema, value, at string, out *[]problem.FieldError) {
+	name := fieldName(at)
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		*out = append(*out, problem.Field(name, "too_short", fmt.Sprintf("%s must be at least %d characters", name, *schema.MinLength)))
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		*out = append(*out, problem.Field(name, "too_long", fmt.Sprintf("%s must be at most %d characters", name, *schema.MaxLength)))
+	}
+	if len(schema.Enum) > 0 && !contains(schema.Enum, value) {
+		*out = append(*out, problem.Field(name, "invalid", name+" must be one of "+strings.Join(schema.Enum, ", ")))
+	}
+	if schema.Pattern != "" {
+		compiled, ok := patterns.Load(schema.Pattern)
+		if !ok {
+			compiled, _ = patterns.LoadOrStore(schema.Pattern, regexp.MustCompile(schema.Pattern))
+		}
+		if !compiled.(*regexp.Regexp).MatchString(value) {
+			*out = append(*out, problem.Field(name, "invalid", name+" must match "+schema.Pattern))
+		}
+	}
+}
+
+func checkNumber(schema Schema, value json.Number, at string, out *[]problem.FieldError) {
+	number, err := value.Float64()
+	if err != nil {
+		return
+	}
+	name := fieldName(at)
+	if schema.Minimum != nil && number < float64(*schema.Minimum) {
+		*out = append(*out, problem.Field(name, "too_short", fmt.Sprintf("%s must be at least %d", name, *schema.Minimum)))
+	}
+	if schema.Maximum != nil && number > float64(*schema.Maximum) {
+		*out = append(*out, problem.Field(name, "too_long", fmt.Sprintf("%s must be at most %d", name, *schema.Maximum)))
+	}
+}
+
+func (doc *Document) checkObject(schema Schema, value map[string]interface{}, at string, out *[]problem.FieldError) {
+	for _, name := range schema.Required {
+		if _, ok := value[name]; !ok {
+			field := join(at, name)
+			*out = append(*out, problem.Field(field, "required", field+" is required"))
+		}
+	}
+	// Порядок обхода map случаен, а нарушения должны перечисляться одинаково
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := schema.Properties[name]; ok {
+			doc.checkValue(property, value[name], join(at, name), out)
+		} else if schema.AdditionalProperties != nil {
+			doc.checkValue(*schema.AdditionalProperties, value[name], join(at, name), out)
+		}
+	}
+}
+
+// hasType сообщает, подходит ли JSON значение под type схемы; пустой type допускает любое значение
+func hasType(types interface{}, value interface{}) bool {
+	switch types := types.(type) {
+	case nil:
+		return true
+	case string:
+		return isType(types, value)
+	case []string:
+		for _, name := range types {
+			if isType(name, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case json.Number:
+		if name == "number" {
+			return true
+		}
+		_, err := value.Int64()
+		return name == "integer" && err == nil
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	}
+	return false
+}
+
+func typeList(types interface{}) string {
+	if list, ok := types.([]string); ok {
+		return strings.Join(list, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+// decodeJSON разбирает тело так, чтобы целые числа можно было отличить от дробных
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+func join(at, name string) string {
+	if at == "" {
+		return name
+	}
+	return at + "." + name
+}
+
+// fieldName называет корень документа body, остальные значения — путем через точку
+func fieldName(at string) string {
+	if at == "" {
+		return "body"
+	}
+	return at
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package apidoc
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// CodeContractViolation — ответ сервера не совпал с OpenAPI документом (только в режиме reject)
+const CodeContractViolation = "contract_violation"
+
+// Contract сверяет каждый запрос и ответ с документом, пути которого заданы от корня роутера.
+// Нарушения пишутся в лог; при reject запрос с нарушением отклоняется с тем же статусом, каким
+// ответил бы обработчик (400, 415 или 422), а ответ с нарушением заменяется на 500.
+// Ответ буферизуется целиком, поэтому проверка предназначена для разработки и тестов.
+// Запросы, для которых в документе нет операции, пропускаются без проверки.
+func Contract(doc Document, reject bool) func(http.Handler) http.Handler {
+	operations := newOperationIndex(doc)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, params, ok := operations.find(r.Method, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if p := doc.checkRequest(op, params, r); p != nil {
+				log.Printf("OpenAPI contract: request %s %s: %s", r.Method, r.URL.Path, describe(p))
+				if reject {
+					problem.Render(w, r, p)
+					return
+				}
+			}
+
+			recorded := &bufferedResponse{header: w.Header()}
+			next.ServeHTTP(recorded, r)
+			if recorded.status == 0 {
+				recorded.status = http.StatusOK
+			}
+
+			if violations := doc.checkResponse(op, recorded); len(violations) > 0 {
+				log.Printf("OpenAPI contract: response %d to %s %s: %s", recorded.status, r.Method, r.URL.Path, describe(&problem.Problem{Errors: violations}))
+				if reject {
+					p := problem.New(http.StatusInternalServerError, CodeContractViolation, "response does not match the OpenAPI document")
+					p.Errors = violations
+					problem.Render(w, r, p)
+					return
+				}
+			}
+			w.WriteHeader(recorded.status)
+			w.Write(recorded.body.Bytes())
+		})
+	}
+}
+
+// checkRequest возвращает ответ, которым запрос был бы отклонен, или nil. Запрос без учетных данных
+// к защищенной операции не проверяется: его отклонит проверка токена, и статус 401 не должен меняться.
+func (doc *Document) checkRequest(op Operation, params map[string]string, r *http.Request) *problem.Problem {
+	if requiresAuth(op) && r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" {
+		return nil
+	}
+	var invalid []problem.FieldError
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		value, present := params[param.Name], true
+		switch param.In {
+		case "query":
+			present = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		}
+		if !present {
+			if param.Required {
+				invalid = append(invalid, problem.Field(param.Name, "required", param.Name+" is required"))
+			}
+			continue
+		}
+		if param.Schema.Type == "integer" {
+			if _, err := strconv.Atoi(value); err != nil {
+				invalid = append(invalid, problem.Field(param.Name, "type", param.Name+" must be integer"))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		p := problem.BadRequest(problem.CodeInvalidParameter, "request parameters do not match the OpenAPI document")
+		p.Errors = invalid
+		return p
+	}
+
+	if op.RequestBody == nil || r.Body == nil || r.Body == http.NoBody {
+		if op.RequestBody != nil && op.RequestBody.Required {
+			return problem.BadRequest(problem.CodeInvalidRequest, "request body is empty")
+		}
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	// Обработчик получает тело без изменений, включая ошибку чтения, например превышение размера
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+	if err != nil {
+		return nil
+	}
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			return problem.BadRequest(problem.CodeInvalidRequest, "request body is empty")
+		}
+		return nil
+	}
+
+	contentType := mediaType(r.Header.Get("Content-Type"))
+	if contentType == "" {
+		contentType = "application/json" // Обработчики разбирают тело без Content-Type как JSON
+	}
+	media, ok := op.RequestBody.Content[contentType]
+	if !ok {
+		return problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, contentType+" is not accepted here")
+	}
+	value, err := decodeJSON(body)
+	if err != nil {
+		return nil // Неразборчивый JSON обработчик отклонит сам, с точным описанием ошибки
+	}
+	doc.checkValue(media.Schema, value, "", &invalid)
+	if len(invalid) > 0 {
+		return problem.Validation(invalid...)
+	}
+	return nil
+}
+
+// checkResponse возвращает нарушения ответа: недокументированный статус, тип содержимого или тело
+func (doc *Document) checkResponse(op Operation, recorded *bufferedResponse) []problem.FieldError {
+	status := strconv.Itoa(recorded.status)
+	documented, ok := op.Responses[status]
+	if !ok {
+		return []problem.FieldError{problem.Field("status", "undocumented", "status "+status+" is not documented")}
+	}
+	if len(documented.Content) == 0 {
+		// http.Redirect добавляет к перенаправлению короткую HTML ссылку, ее не описывают
+		if recorded.body.Len() > 0 && (recorded.status < 300 || recorded.status >= 400) {
+			return []problem.FieldError{problem.Field("body", "undocumented", "status "+status+" is documented without a body")}
+		}
+		return nil
+	}
+
+	contentType := mediaType(recorded.header.Get("Content-Type"))
+	media, ok := documented.Content[contentType]
+	if !ok {
+		return []problem.FieldError{problem.Field("Content-Type", "undocumented", contentType+" is not documented for status "+status)}
+	}
+	if contentType != "application/json" && !strings.HasSuffix(contentType, "+json") {
+		return nil // Тела в форматах кроме JSON сверяются только по типу содержимого
+	}
+	value, err := decodeJSON(recorded.body.Bytes())
+	if err != nil {
+		return []problem.FieldError{problem.Field("body", "invalid", "body is not valid JSON")}
+	}
+	var invalid []problem.FieldError
+	doc.checkValue(media.Schema, value, "", &invalid)
+	return invalid
+}
+
+// operationIndex находит операцию документа по методу и пути запроса
+type operationIndex []operationEntry
+
+type operationEntry struct {
+	method   string
+	segments []string
+	params   int
+	op       Operation
+}
+
+func newOperationIndex(doc Document) operationIndex {
+	var index operationIndex
+	for path, methods := range doc.Paths {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		params := 0
+		for _, segment := range segments {
+			if strings.HasPrefix(segment, "{") {
+				params++
+			}
+		}
+		for method, op := range methods {
+			index = append(index, operationEntry{method: strings.ToUpper(method), segments: segments, params: params, op: op})
+		}
+	}
+	return index
+}
+
+// find выбирает операцию с наименьшим числом параметров пути, как chi предпочитает статические сегменты
+func (index operationIndex) find(method, path string) (Operation, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *operationEntry
+	for i := range index {
+		entry := &index[i]
+		if entry.method != method || len(entry.segments) != len(segments) || (best != nil && entry.params >= best.params) {
+			continue
+		}
+		if entry.matches(segments) {
+			best = entry
+		}
+	}
+	if best == nil {
+		return Operation{}, nil, false
+	}
+	params := make(map[string]string, best.params)
+	for i, segment := range best.segments {
+		if strings.HasPrefix(segment, "{") {
+			params[strings.Trim(segment, "{}")] = segments[i]
+		}
+	}
+	return best.op, params, true
+}
+
+func (entry *operationEntry) matches(segments []string) bool {
+	for i, segment := range entry.segments {
+		if strings.HasPrefix(segment, "{") {
+			if segments[i] == "" {
+				return false
+			}
+		} else if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bufferedResponse задерживает ответ обработчика до проверки; заголовки пишутся сразу в исходный ответ
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+type errorReader struct{ err error }
+
+func (e errorReader) Read([]byte) (int, error) {
+	if e.err == nil {
+		return 0, io.EOF
+	}
+	return 0, e.err
+}
+
+func mediaType(header string) string {
+	media, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	return media
+}
+
+// describe перечисляет нарушения для лога
+func describe(p *problem.Problem) string {
+	if len(p.Errors) == 0 {
+		return p.Detail
+	}
+	messages := make([]string, 0, len(p.Errors))
+	for _, violation := range p.Errors {
+		messages = append(messages, violation.Field+": "+violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// requiresAuth сообщает, что операция недоступна без входа: среди требований нет пустого
+func requiresAuth(op Operation) bool {
+	for _, requirement := range op.Security {
+		if len(requirement) == 0 {
+			return false
+		}
+	}
+	return len(op.Security) > 0
+}
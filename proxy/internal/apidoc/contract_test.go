@@ -0,0 +1,61 @@
+package apidoc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+func TestContract(t *testing.T) {
+	doc := Build(Info{PathParamTypes: map[string]string{"index": "integer"}}, []Route{
+		{Method: http.MethodPut, Path: "/books/{index}", Request: testBook{}, Response: testBook{}, Errors: []int{http.StatusNotFound}},
+		{Method: http.MethodGet, Path: "/books/trash", Response: []testBook{}},
+	})
+	valid := `{"index":1,"title":"Dune","role":"admin","block":false,"tags":null}`
+
+	tests := []struct {
+		name, method, path, body, response string
+		reject                             bool
+		status                             int
+		code                               string
+		called                             bool
+	}{
+		{name: "valid exchange", method: http.MethodPut, path: "/books/1", body: valid, response: valid, reject: true, status: http.StatusOK, called: true},
+		{name: "invalid path parameter", method: http.MethodPut, path: "/books/abc", body: valid, reject: true, status: http.StatusBadRequest, code: problem.CodeInvalidParameter},
+		{name: "invalid body", method: http.MethodPut, path: "/books/1", body: `{"index":1.5,"role":"guest","block":true}`, reject: true, status: http.StatusUnprocessableEntity, code: problem.CodeValidation},
+		{name: "invalid body is only logged", method: http.MethodPut, path: "/books/1", body: `{}`, response: valid, status: http.StatusOK, called: true},
+		{name: "invalid response", method: http.MethodPut, path: "/books/1", body: valid, response: `{"title":7}`, reject: true, status: http.StatusInternalServerError, code: CodeContractViolation, called: true},
+		{name: "static segment wins", method: http.MethodGet, path: "/books/trash", response: `[]`, reject: true, status: http.StatusOK, called: true},
+		{name: "undocumented route", method: http.MethodDelete, path: "/books/1", reject: true, status: http.StatusOK, called: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := Contract(doc, tt.reject)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.Header().Set("Content-Type", "application/json;charset=utf-8")
+				w.Write([]byte(tt.response))
+			}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status || called != tt.called {
+				t.Fatalf("status = %d, handler called = %v; body %s", w.Code, called, w.Body)
+			}
+			if tt.code == "" {
+				if w.Body.String() != tt.response {
+					t.Errorf("body = %s, want the handler response", w.Body)
+				}
+				return
+			}
+			var p problem.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Code != tt.code {
+				t.Errorf("problem = %+v (%v), want code %s", p, err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package apidoc
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+)
+
+// Schema — JSON Schema (диалект OpenAPI 3.1). Type — строка или список, например ["string", "null"].
+type Schema struct {
+	Ref                  string            `json:"$ref,omitempty"`
+	Type                 interface{}       `json:"type,omitempty"`
+	Format               string            `json:"format,omitempty"`
+	Properties           map[string]Schema `json:"properties,omitempty"`
+	Required             []string          `json:"required,omitempty"`
+	Items                *Schema           `json:"items,omitempty"`
+	AdditionalProperties *Schema           `json:"additionalProperties,omitempty"`
+	Enum                 []string          `json:"enum,omitempty"`
+	Pattern              string            `json:"pattern,omitempty"`
+	MinLength            *int              `json:"minLength,omitempty"`
+	MaxLength            *int              `json:"maxLength,omitempty"`
+	MinItems             *int              `json:"minItems,omitempty"`
+	MaxItems             *int              `json:"maxItems,omitempty"`
+	Minimum              *int              `json:"minimum,omitempty"`
+	Maximum              *int              `json:"maximum,omitempty"`
+	OneOf                []Schema          `json:"oneOf,omitempty"`
+	AnyOf                []Schema          `json:"anyOf,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaSet выносит именованные структуры в components.schemas под именами вида models.User
+type schemaSet struct {
+	components map[string]Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: make(map[string]Schema), names: make(map[reflect.Type]string)}
+}
+
+// of возвращает схему типа значения v
+func (s *schemaSet) of(v interface{}) Schema {
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemaSet) schema(t reflect.Type) Schema {
+	switch {
+	case t == timeType:
+		return Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return Schema{} // Любое значение JSON
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(s.schema(t.Elem()))
+	case reflect.Bool:
+		return Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{Type: "number"}
+	case reflect.String:
+		return Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{Type: "string", Format: "byte"}
+		}
+		items := s.schema(t.Elem())
+		return Schema{Type: "array", Items: &items}
+	case reflect.Map:
+		// Ключи любых типов кодируются в JSON строками
+		values := s.schema(t.Elem())
+		return Schema{Type: "object", AdditionalProperties: &values}
+	case reflect.Struct:
+		return s.structRef(t)
+	}
+	return Schema{} // interface{} и прочее — любое значение
+}
+
+// structRef регистрирует структуру в components и возвращает ссылку на нее; анонимные структуры описываются на месте
+func (s *schemaSet) structRef(t reflect.Type) Schema {
+	if t.Name() == "" {
+		return s.object(t)
+	}
+	if name, ok := s.names[t]; ok {
+		return Schema{Ref: "#/components/schemas/" + name}
+	}
+	name := path.Base(t.PkgPath()) + "." + t.Name()
+	s.names[t] = name
+	s.components[name] = Schema{} // Заглушка на случай рекурсивных типов
+	s.components[name] = s.object(t)
+	return Schema{Ref: "#/components/schemas/" + name}
+}
+
+// optional снимает обязательность полей со схемы объекта или элементов списка. Меняется сам компонент,
+// поэтому тип должен описывать только ответы с выбором полей.
+func (s *schemaSet) optional(schema Schema) {
+	if schema.Items != nil {
+		s.optional(*schema.Items)
+		return
+	}
+	if name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok {
+		component := s.components[name]
+		component.Required = nil
+		s.components[name] = component
+	}
+}
+
+func (s *schemaSet) object(t reflect.Type) Schema {
+	object := Schema{Type: "object", Properties: make(map[string]Schema)}
+	s.addFields(&object, t)
+	return object
+}
+
+// addFields описывает поля так же, как их видит encoding/json, и переносит правила тегов validate
+func (s *schemaSet) addFields(object *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(object, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.schema(field.Type)
+		if kind := field.Type.Kind(); (kind == reflect.Slice || kind == reflect.Map) && !strings.Contains(","+options+",", ",omitempty,") {
+			schema = nullable(schema) // encoding/json пишет nil срез и map как null
+		}
+		if applyRules(&schema, field.Tag.Get("validate")) {
+			object.Required = append(object.Required, name)
+		}
+		object.Properties[name] = schema
+	}
+}
+
+// applyRules переносит правила validate в схему и сообщает, обязательно ли поле
+func applyRules(schema *Schema, tag string) (required bool) {
+	if tag == "" || tag == "-" || schema.Ref != "" {
+		return tag != "" && strings.Contains(","+tag+",", ",required,")
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "min", "max":
+			limit, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			switch baseType(schema) {
+			case "string":
+				if name == "min" {
+					schema.MinLength = &limit
+				} else {
+					schema.MaxLength = &limit
+				}
+			case "array":
+				if name == "min" {
+					schema.MinItems = &limit
+				} else {
+					schema.MaxItems = &limit
+				}
+			case "integer", "number":
+				if name == "min" {
+					schema.Minimum = &limit
+				} else {
+					schema.Maximum = &limit
+				}
+			}
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "email":
+			schema.Format = "email"
+		case "username":
+			schema.Pattern = validate.UsernamePattern.String()
+		}
+	}
+	return required
+}
+
+// baseType возвращает тип схемы без null
+func baseType(schema *Schema) string {
+	switch t := schema.Type.(type) {
+	case string:
+		return t
+	case []string:
+		return t[0]
+	}
+	return ""
+}
+
+// nullable разрешает null: для простых типов добавляет его в type, ссылки оборачивает в anyOf
+func nullable(schema Schema) Schema {
+	switch t := schema.Type.(type) {
+	case string:
+		schema.Type = []string{t, "null"}
+		return schema
+	case []string:
+		return schema
+	}
+	if schema.Ref == "" && schema.Type == nil {
+		return schema // Любое значение уже допускает null
+	}
+	return Schema{AnyOf: []Schema{schema, {Type: "null"}}}
+}
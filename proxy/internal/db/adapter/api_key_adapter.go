@@ -0,0 +1,84 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresAPIKeyRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{Db: db}
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, mfa"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.MFA)
+	return key, err
+}
+
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key models.APIKey, keyHash string) (models.APIKey, error) {
+	row := r.Db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, mfa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		key.UserID, key.Name, key.Prefix, keyHash, pq.Array(key.Scopes), key.ExpiresAt, key.MFA)
+	return scanAPIKey(row)
+}
+
+func (r *PostgresAPIKeyRepository) GetActiveByHash(ctx context.Context, keyHash string) (models.APIKey, error) {
+	row := r.Db.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`, keyHash)
+	return scanAPIKey(row)
+}
+
+func (r *PostgresAPIKeyRepository) ListForUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := r.Db.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresAPIKeyRepository) Revoke(ctx context.Context, userID, id int) error {
+	query := "UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	return execAffectingRow(ctx, r.Db, query, id, userID)
+}
+
+func (r *PostgresAPIKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	_, err := r.Db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", id, at)
+	return err
+}
+
+func (r *PostgresAPIKeyRepository) ClearMFA(ctx context.Context, userID int) error {
+	_, err := r.Db.ExecContext(ctx, "UPDATE api_keys SET mfa = FALSE WHERE user_id = $1 AND mfa", userID)
+	return err
+}
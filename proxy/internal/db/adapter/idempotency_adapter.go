@@ -0,0 +1,62 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresIdempotencyRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresIdempotencyRepository(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{Db: db}
+}
+
+// Reserve вставляет незавершенную запись, которая держит ключ record.Lease; истекшая запись с тем же
+// ключом занимается заново, как и незавершенная с истекшим сроком удержания: к этому времени срок
+// запроса, занявшего ключ, прошел, значит запрос прерван или процесс упал. Вставка и проверка
+// выполняются одним запросом, поэтому из одновременных повторов ключ займет только один.
+func (r *PostgresIdempotencyRepository) Reserve(ctx context.Context, record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	err := r.Db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))
+		ON CONFLICT (scope, idempotency_key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash, status = 0, content_type = '', location = '', body = '',
+			created_at = NOW(), expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expires_at < NOW()
+			OR (idempotency_keys.status = 0 AND idempotency_keys.locked_until < NOW())
+		RETURNING scope`, record.Scope, record.Key, record.RequestHash, record.ExpiresAt, record.Lease.Seconds()).Scan(&record.Scope)
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	existing := models.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	err = r.Db.QueryRowContext(ctx, `
+		SELECT request_hash, status, content_type, location, body, expires_at FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2`, record.Scope, record.Key).
+		Scan(&existing.RequestHash, &existing.Status, &existing.ContentType, &existing.Location, &existing.Body, &existing.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *PostgresIdempotencyRepository) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	_, err := r.Db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status = $3, content_type = $4, location = $5, body = $6
+		WHERE scope = $1 AND idempotency_key = $2`,
+		record.Scope, record.Key, record.Status, record.ContentType, record.Location, record.Body)
+	return err
+}
+
+func (r *PostgresIdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	_, err := r.Db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND status = 0", scope, key)
+	return err
+}
@@ -0,0 +1,27 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+)
+
+type PostgresExternalIdentityRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresExternalIdentityRepository(db *sql.DB) *PostgresExternalIdentityRepository {
+	return &PostgresExternalIdentityRepository{Db: db}
+}
+
+func (r *PostgresExternalIdentityRepository) GetUserID(ctx context.Context, issuer, subject string) (int, error) {
+	var userID int
+	err := r.Db.QueryRowContext(ctx,
+		"SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2", issuer, subject).Scan(&userID)
+	return userID, err
+}
+
+func (r *PostgresExternalIdentityRepository) Link(ctx context.Context, issuer, subject string, userID int) error {
+	_, err := r.Db.ExecContext(ctx,
+		"INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)", issuer, subject, userID)
+	return err
+}
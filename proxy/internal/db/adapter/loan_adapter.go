@@ -0,0 +1,99 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresLoanRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresLoanRepository(db *sql.DB) *PostgresLoanRepository {
+	return &PostgresLoanRepository{Db: db}
+}
+
+// openLoans — невозвращенные выдачи с названием книги и логином читателя; для книги берется последняя выдача
+const openLoans = `
+	SELECT DISTINCT ON (l.book_index) l.id, l.book_index, COALESCE(b.book, ''), l.user_id, COALESCE(u.username, ''), l.taken_at
+	FROM loans l
+	LEFT JOIN book b ON b.index = l.book_index
+	LEFT JOIN users u ON u.id = l.user_id
+	WHERE l.returned_at IS NULL AND `
+
+// openHolds — действующие брони с местом в очереди на книгу
+const openHolds = `
+	SELECT id, book_index, book, user_id, username, position, created_at FROM (
+		SELECT h.id, h.book_index, COALESCE(b.book, '') AS book, h.user_id, u.username, h.created_at,
+			ROW_NUMBER() OVER (PARTITION BY h.book_index ORDER BY h.created_at, h.id) AS position
+		FROM holds h
+		JOIN users u ON u.id = h.user_id
+		LEFT JOIN book b ON b.index = h.book_index
+		WHERE h.closed_at IS NULL
+	) queue WHERE `
+
+// OpenLoansByBooks возвращает невозвращенные выдачи книг, по одной на книгу
+func (r *PostgresLoanRepository) OpenLoansByBooks(ctx context.Context, indexes []int) ([]models.Loan, error) {
+	return r.loans(ctx, openLoans+"l.book_index = ANY($1) ORDER BY l.book_index, l.taken_at DESC", indexes)
+}
+
+// OpenLoansByUsers возвращает невозвращенные выдачи читателей
+func (r *PostgresLoanRepository) OpenLoansByUsers(ctx context.Context, userIDs []int) ([]models.Loan, error) {
+	return r.loans(ctx, openLoans+"l.user_id = ANY($1) ORDER BY l.book_index, l.taken_at DESC", userIDs)
+}
+
+// HoldsByBooks возвращает действующие брони книг в порядке очереди
+func (r *PostgresLoanRepository) HoldsByBooks(ctx context.Context, indexes []int) ([]models.Hold, error) {
+	return r.holds(ctx, openHolds+"book_index = ANY($1) ORDER BY book_index, position", indexes)
+}
+
+// HoldsByUsers возвращает действующие брони читателей
+func (r *PostgresLoanRepository) HoldsByUsers(ctx context.Context, userIDs []int) ([]models.Hold, error) {
+	return r.holds(ctx, openHolds+"user_id = ANY($1) ORDER BY created_at, id", userIDs)
+}
+
+func (r *PostgresLoanRepository) loans(ctx context.Context, query string, ids []int) ([]models.Loan, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := r.Db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []models.Loan
+	for rows.Next() {
+		var loan models.Loan
+		if err := rows.Scan(&loan.ID, &loan.BookIndex, &loan.Book, &loan.UserID, &loan.Username, &loan.TakenAt); err != nil {
+			return nil, err
+		}
+		loans = append(loans, loan)
+	}
+	return loans, rows.Err()
+}
+
+func (r *PostgresLoanRepository) holds(ctx context.Context, query string, ids []int) ([]models.Hold, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := r.Db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []models.Hold
+	for rows.Next() {
+		var hold models.Hold
+		if err := rows.Scan(&hold.ID, &hold.BookIndex, &hold.Book, &hold.UserID, &hold.Username, &hold.Position, &hold.CreatedAt); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
@@ -0,0 +1,69 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresLoginAttemptRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresLoginAttemptRepository(db *sql.DB) *PostgresLoginAttemptRepository {
+	return &PostgresLoginAttemptRepository{Db: db}
+}
+
+// RecordFailure атомарно увеличивает счетчик неудачных попыток
+func (r *PostgresLoginAttemptRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures int
+	err := r.Db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func (r *PostgresLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.Db.ExecContext(ctx, "UPDATE login_attempts SET locked_until = $2 WHERE attempt_key = $1", key, until)
+	return err
+}
+
+func (r *PostgresLoginAttemptRepository) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until sql.NullTime
+	err := r.Db.QueryRowContext(ctx, "SELECT locked_until FROM login_attempts WHERE attempt_key = $1", key).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+func (r *PostgresLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.Db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempt_key = $1", key)
+	return err
+}
+
+type PostgresAuditRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{Db: db}
+}
+
+func (r *PostgresAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	_, err := r.Db.ExecContext(ctx,
+		"INSERT INTO audit_log (event, actor_id, username, ip, details) VALUES ($1, $2, $3, $4, $5)",
+		entry.Event, entry.ActorID, entry.Username, entry.IP, entry.Details)
+	return err
+}
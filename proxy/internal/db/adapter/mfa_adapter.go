@@ -0,0 +1,92 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresMFARepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresMFARepository(db *sql.DB) *PostgresMFARepository {
+	return &PostgresMFARepository{Db: db}
+}
+
+func (r *PostgresMFARepository) Get(ctx context.Context, userID int) (models.MFA, error) {
+	mfa := models.MFA{UserID: userID}
+	err := r.Db.QueryRowContext(ctx,
+		"SELECT secret, confirmed_at, last_used_step FROM user_mfa WHERE user_id = $1", userID).
+		Scan(&mfa.Secret, &mfa.ConfirmedAt, &mfa.LastUsedStep)
+	if err != nil {
+		return models.MFA{}, err
+	}
+	return mfa, nil
+}
+
+func (r *PostgresMFARepository) SaveSecret(ctx context.Context, userID int, secret string) error {
+	_, err := r.Db.ExecContext(ctx, `
+		INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed_at = NULL, last_used_step = 0, created_at = NOW()`,
+		userID, secret)
+	return err
+}
+
+func (r *PostgresMFARepository) Confirm(ctx context.Context, userID int, step int64) error {
+	query := "UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL"
+	return execAffectingRow(ctx, r.Db, query, userID, step)
+}
+
+func (r *PostgresMFARepository) Disable(ctx context.Context, userID int) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) UseStep(ctx context.Context, userID int, step int64) error {
+	query := "UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+	return execAffectingRow(ctx, r.Db, query, userID, step)
+}
+
+func (r *PostgresMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE id = (SELECT id FROM mfa_recovery_codes WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL LIMIT 1)`
+	return execAffectingRow(ctx, r.Db, query, userID, hash)
+}
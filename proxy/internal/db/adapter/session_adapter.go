@@ -0,0 +1,165 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+type PostgresSessionRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresSessionRepository(db *sql.DB) *PostgresSessionRepository {
+	return &PostgresSessionRepository{Db: db}
+}
+
+// Create сохраняет новую сессию вместе с первым токеном обновления
+func (r *PostgresSessionRepository) Create(ctx context.Context, session models.Session, refreshHash string, expiresAt time.Time) error {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO sessions (id, user_id, user_agent, ip, mfa) VALUES ($1, $2, $3, $4, $5)",
+		session.ID, session.UserID, session.UserAgent, session.IP, session.MFA)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES ($1, $2, $3)",
+		refreshHash, session.ID, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Rotate заменяет токен обновления новым в рамках той же сессии
+func (r *PostgresSessionRepository) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (models.Session, error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Session{}, err
+	}
+	defer tx.Rollback()
+
+	var session models.Session
+	var tokenExpiresAt time.Time
+	var usedAt *time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.revoked_at, s.mfa, t.expires_at, t.used_at
+		FROM refresh_tokens t JOIN sessions s ON s.id = t.session_id
+		WHERE t.token_hash = $1
+		FOR UPDATE`, oldHash).
+		Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt,
+			&session.RevokedAt, &session.MFA, &tokenExpiresAt, &usedAt)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	switch {
+	case session.RevokedAt != nil:
+		return models.Session{}, postgres.ErrSessionRevoked
+	case usedAt != nil:
+		// Токен уже был обменян: вероятно, он украден, поэтому закрываем всю сессию
+		if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE id = $1", session.ID); err != nil {
+			return models.Session{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return models.Session{}, err
+		}
+		return session, postgres.ErrRefreshTokenReused
+	case time.Now().After(tokenExpiresAt):
+		return models.Session{}, postgres.ErrRefreshTokenExpired
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1", oldHash); err != nil {
+		return models.Session{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, session_id, expires_at) VALUES ($1, $2, $3)",
+		newHash, session.ID, expiresAt)
+	if err != nil {
+		return models.Session{}, err
+	}
+	err = tx.QueryRowContext(ctx, "UPDATE sessions SET last_seen_at = NOW() WHERE id = $1 RETURNING last_seen_at", session.ID).
+		Scan(&session.LastSeenAt)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, tx.Commit()
+}
+
+// Revoke закрывает сессию; выданные в ней токены перестают приниматься
+func (r *PostgresSessionRepository) Revoke(ctx context.Context, sessionID string) error {
+	query := "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL"
+	return execAffectingRow(ctx, r.Db, query, sessionID)
+}
+
+// RevokeAllForUser закрывает все активные сессии пользователя и возвращает их идентификаторы
+func (r *PostgresSessionRepository) RevokeAllForUser(ctx context.Context, userID int) ([]string, error) {
+	rows, err := r.Db.QueryContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL RETURNING id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListActiveForUser возвращает активные сессии пользователя, начиная с последней использованной
+func (r *PostgresSessionRepository) ListActiveForUser(ctx context.Context, userID int) ([]models.Session, error) {
+	rows, err := r.Db.QueryContext(ctx, `
+		SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.mfa
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL
+			AND EXISTS (
+				SELECT 1 FROM refresh_tokens t
+				WHERE t.session_id = s.id AND t.used_at IS NULL AND t.expires_at > NOW()
+			)
+		ORDER BY s.last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.MFA); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeForUser закрывает сессию пользователя; чужая или уже закрытая сессия дает sql.ErrNoRows
+func (r *PostgresSessionRepository) RevokeForUser(ctx context.Context, userID int, sessionID string) error {
+	query := "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	return execAffectingRow(ctx, r.Db, query, sessionID, userID)
+}
+
+// IsRevoked проверяет, закрыта ли сессия; неизвестная сессия считается закрытой
+func (r *PostgresSessionRepository) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	var revoked bool
+	err := r.Db.QueryRowContext(ctx, "SELECT revoked_at IS NOT NULL FROM sessions WHERE id = $1", sessionID).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return revoked, err
+}
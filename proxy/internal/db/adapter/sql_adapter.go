@@ -2,109 +2,546 @@ package adapter
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi"
+	"github.com/lib/pq"
 
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/password"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/negotiate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/patch"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
 )
 
+// CreateUser создает пользователя с заданным паролем и возвращает его с адресом в заголовке Location
 func (uc *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validate.Decode(w, r, &user); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	if err := uc.UserRepo.Create(context.Background(), user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Пароль обязателен только при создании, поэтому проверяется здесь, а не тегами модели
+	fields := validate.Fields(user)
+	if user.Password == "" {
+		fields = append(fields, problem.Field("password", "required", "password is required"))
+	} else if err := password.Validate(user.Password, user.Username); err != nil {
+		fields = append(fields, problem.Field("password", "weak", err.Error()))
+	}
+	if len(fields) > 0 {
+		problem.Write(w, r, problem.Validation(fields...))
+		return
+	}
+	hash, err := password.Hash(user.Password)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	user.PasswordHash = hash
+
+	id, err := uc.UserRepo.Create(r.Context(), user)
+	if isUniqueViolation(err) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeAlreadyExists, "username is already taken")
 		return
 	}
-	json.NewEncoder(w).Encode(CreateResponse{Message: "Create successful"})
-	w.WriteHeader(http.StatusCreated)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	created, err := uc.UserRepo.GetByID(r.Context(), strconv.Itoa(id))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/api/users/"+strconv.Itoa(id))
+	writeJSON(w, http.StatusCreated, created)
 }
 
+// GetUser возвращает пользователя; fields= оставляет перечисленные поля, include= встраивает loans и holds
 func (uc *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	user, err := uc.UserRepo.GetByID(context.Background(), id)
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	sel, err := userSelection(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(CreateResponse{Message: "Great successful"})
-	json.NewEncoder(w).Encode(user)
+	user, err := uc.UserRepo.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	views, err := uc.embedUsers(r.Context(), []models.User{user}, sel)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	body, err := sel.Apply(views[0])
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
 }
 
+// UpdateUser заменяет логин, имя, адрес и роль пользователя с ID из пути. Пароль меняется отдельными эндпоинтами.
 func (uc *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
 	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validate.DecodeJSON(w, r, &user); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	if err := uc.UserRepo.Update(context.Background(), user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Ресурс определяется адресом; id в теле допускается, только если совпадает с ним
+	if user.ID != 0 && strconv.Itoa(user.ID) != id {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeReadOnlyField, "id does not match the path")
 		return
 	}
-	json.NewEncoder(w).Encode(CreateResponse{Message: "Update successful"})
-	w.WriteHeader(http.StatusNoContent)
+	if user.Password != "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeReadOnlyField, "password cannot be changed with this endpoint")
+		return
+	}
+	user.ID, _ = strconv.Atoi(id)
+
+	err := uc.UserRepo.Update(r.Context(), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if isUniqueViolation(err) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeAlreadyExists, "username is already taken")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	updated, err := uc.UserRepo.GetByID(r.Context(), id)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
 }
 
+// PatchUser применяет JSON Merge Patch или JSON Patch к пользователю; роль меняет только администратор
+func (uc *UserController) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	patchBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	current, err := uc.UserRepo.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	patched, err := patch.Apply(r.Header.Get("Content-Type"), doc, patchBody)
+	switch {
+	case errors.Is(err, patch.ErrUnsupportedMediaType):
+		problem.Error(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, err.Error())
+		return
+	case errors.Is(err, patch.ErrTestFailed):
+		problem.Error(w, r, http.StatusConflict, problem.CodePatchTestFailed, err.Error())
+		return
+	case err != nil:
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var user models.User
+	if err := validate.Unmarshal(patched, &user); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	// Идентификатор и отметка об удалении изменяются только сервером
+	if user.ID != current.ID || user.DeletedAt != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeReadOnlyField, "id and deleted_at are read-only")
+		return
+	}
+	// Роль назначает только администратор
+	if identity, _ := service.FromContext(r.Context()); user.Role != current.Role && !identity.Can(service.PermUsersManage) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "insufficient permissions to change role")
+		return
+	}
+	if user.Password != "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeReadOnlyField, "password cannot be changed with this endpoint")
+		return
+	}
+	if err := validate.Struct(user); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = uc.UserRepo.Update(r.Context(), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if isUniqueViolation(err) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeAlreadyExists, "username is already taken")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	// Возвращается сохраненное состояние: сервер мог сбросить подтверждение адреса
+	updated, err := uc.UserRepo.GetByID(r.Context(), id)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteUser помечает пользователя удаленным. Пользователя с выданными книгами или неоплаченными штрафами удалить нельзя.
 func (uc *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if err := uc.UserRepo.Delete(context.Background(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := uc.UserRepo.Delete(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if errors.Is(err, postgres.ErrUserHasOpenLoans) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeBooksOnLoan, "user has books on loan")
+		return
+	}
+	if errors.Is(err, postgres.ErrUserHasUnpaidFines) {
+		problem.Error(w, r, http.StatusConflict, problem.CodeUnpaidFines, "user has unpaid fines")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUserWithDeleted возвращает пользователя по ID, включая удаленных (для администраторов)
+func (uc *UserController) GetUserWithDeleted(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	user, err := uc.UserRepo.GetByIDWithDeleted(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	json.NewEncoder(w).Encode(user)
+}
+
+// RestoreUser восстанавливает удаленного пользователя
+func (uc *UserController) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	err := uc.UserRepo.Restore(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "deleted user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	json.NewEncoder(w).Encode(CreateResponse{Message: "Restore successful"})
+}
+
+// PurgeUser окончательно удаляет пользователя, ранее помеченного как удаленный
+func (uc *UserController) PurgeUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	err := uc.UserRepo.Purge(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "deleted user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(CreateResponse{Message: "Delete successful"})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListUsers возвращает страницу активных пользователей по возрастанию ID. fields= и include= — как в GetUser;
+// каждая связь загружается одним запросом на всю страницу.
 func (uc *UserController) ListUsers(w http.ResponseWriter, r *http.Request) {
-	limit := 10 // Установите значение по умолчанию
-	offset := 0 // Установите значение по умолчанию
-	users, err := uc.UserRepo.List(context.Background(), limit, offset)
+	limit, err := queryInt(r, "limit", defaultUsersLimit)
+	if err != nil || limit < 1 || limit > maxUsersLimit {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter,
+			fmt.Sprintf("limit must be an integer from 1 to %d", maxUsersLimit))
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "offset must be a non-negative integer")
+		return
+	}
+	sel, err := userSelection(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(CreateResponse{Message: "List successful"})
-	json.NewEncoder(w).Encode(users)
+	users, err := uc.UserRepo.List(r.Context(), limit, offset)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	views, err := uc.embedUsers(r.Context(), users, sel) // Пустая страница — пустой массив, а не null
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	body, err := sel.Apply(views)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := negotiate.Write(w, r, http.StatusOK, body); err != nil {
+		problem.Write(w, r, err)
+	}
 }
 
-func (r *PostgresUserRepository) Create(ctx context.Context, user models.User) error {
-	query := "INSERT INTO users (id, name, email) VALUES ($1, $2, $3)"
-	_, err := r.Db.ExecContext(ctx, query, user.ID, user.Name, user.Email)
-	return err
+const (
+	defaultUsersLimit = 10
+	maxUsersLimit     = 100
+)
+
+// userIDParam читает ID пользователя из пути; при неверном ID отвечает 400 и возвращает false
+func userIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := chi.URLParam(r, "id")
+	if n, err := strconv.Atoi(id); err != nil || n < 1 {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+		return "", false
+	}
+	return id, true
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
 }
 
-// GetByID получает пользователя по ID
+// writeJSON отвечает одним JSON документом; статус пишется после заголовков, но до тела
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности (например, занят логин)
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Create добавляет пользователя и возвращает его ID
+func (r *PostgresUserRepository) Create(ctx context.Context, user models.User) (int, error) {
+	if user.Role == "" {
+		user.Role = models.DefaultRole
+	}
+	var id int
+	query := "INSERT INTO users (username, password, name, email, role, must_change_password) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	err := r.Db.QueryRowContext(ctx, query, user.Username, user.PasswordHash, user.Name, user.Email, user.Role, user.MustChangePassword).Scan(&id)
+	return id, err
+}
+
+// GetByID получает пользователя по ID, удаленные пользователи не возвращаются
 func (r *PostgresUserRepository) GetByID(ctx context.Context, id string) (models.User, error) {
 	var user models.User
-	query := "SELECT id, name, email, deleted_at FROM users WHERE id = $1"
-	err := r.Db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.DeletedAt)
+	query := "SELECT id, username, name, email, role, email_verified_at IS NOT NULL, deleted_at FROM users WHERE id = $1 AND deleted_at IS NULL"
+	err := r.Db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.EmailVerified, &user.DeletedAt)
 	if err != nil {
 		return models.User{}, err
 	}
 	return user, nil
 }
 
-// Update обновляет данные пользователя
+// GetByUsername получает активного пользователя по логину вместе с хешем пароля для проверки входа
+func (r *PostgresUserRepository) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	query := "SELECT id, username, password, name, email, role, email_verified_at IS NOT NULL, deleted_at, must_change_password FROM users WHERE username = $1 AND deleted_at IS NULL"
+	err := r.Db.QueryRowContext(ctx, query, username).
+		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Name, &user.Email, &user.Role, &user.EmailVerified, &user.DeletedAt, &user.MustChangePassword)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// GetByIDWithDeleted получает пользователя по ID, в том числе удаленного
+func (r *PostgresUserRepository) GetByIDWithDeleted(ctx context.Context, id string) (models.User, error) {
+	var user models.User
+	query := "SELECT id, username, name, email, role, email_verified_at IS NOT NULL, deleted_at FROM users WHERE id = $1"
+	err := r.Db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.EmailVerified, &user.DeletedAt)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// Update обновляет данные активного пользователя; sql.ErrNoRows, если такого нет
 func (r *PostgresUserRepository) Update(ctx context.Context, user models.User) error {
-	query := "UPDATE users SET name = $1, email = $2 WHERE id = $3"
-	_, err := r.Db.ExecContext(ctx, query, user.Name, user.Email, user.ID)
+	// Смена адреса снимает отметку о его подтверждении
+	query := `UPDATE users SET username = $1, name = $2, email = $3, role = COALESCE(NULLIF($4, ''), role),
+		email_verified_at = CASE WHEN email = $3 THEN email_verified_at ELSE NULL END
+		WHERE id = $5 AND deleted_at IS NULL`
+	return execAffectingRow(ctx, r.Db, query, user.Username, user.Name, user.Email, user.Role, user.ID)
+}
+
+// UpdatePasswordHash заменяет хеш пароля пользователя и снимает требование сменить пароль
+func (r *PostgresUserRepository) UpdatePasswordHash(ctx context.Context, id int, hash string) error {
+	query := "UPDATE users SET password = $1, must_change_password = FALSE WHERE id = $2"
+	_, err := r.Db.ExecContext(ctx, query, hash, id)
 	return err
 }
 
-// Delete помечает пользователя как удаленного
+// MarkEmailVerified подтверждает адрес, если он не менялся с момента отправки письма
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, id int, email string) error {
+	query := "UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email = $2 AND deleted_at IS NULL"
+	return execAffectingRow(ctx, r.Db, query, id, email)
+}
+
+// ListByEmail возвращает активных пользователей с указанным адресом; адрес не уникален
+func (r *PostgresUserRepository) ListByEmail(ctx context.Context, email string) ([]models.User, error) {
+	query := "SELECT id, username, name, email, role, email_verified_at IS NOT NULL, deleted_at FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL ORDER BY id"
+	rows, err := r.Db.QueryContext(ctx, query, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.EmailVerified, &user.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Delete помечает пользователя как удаленного, если у него нет книг на руках и неоплаченных штрафов.
+// Строка пользователя блокируется до конца проверки: новые выдачи и штрафы ссылаются на нее внешним
+// ключом и ждут, пока удаление не завершится.
 func (r *PostgresUserRepository) Delete(ctx context.Context, id string) error {
-	query := "UPDATE users SET deleted_at = NOW() WHERE id = $1"
-	_, err := r.Db.ExecContext(ctx, query, id)
-	return err
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&locked)
+	if err != nil {
+		return err
+	}
+
+	var hasLoans, hasFines bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM loans WHERE user_id = $1 AND returned_at IS NULL),
+		       EXISTS(SELECT 1 FROM fines WHERE user_id = $1 AND paid_at IS NULL)`, id).Scan(&hasLoans, &hasFines)
+	if err != nil {
+		return err
+	}
+	switch {
+	case hasLoans:
+		return postgres.ErrUserHasOpenLoans
+	case hasFines:
+		return postgres.ErrUserHasUnpaidFines
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET deleted_at = NOW() WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore снимает с пользователя отметку об удалении
+func (r *PostgresUserRepository) Restore(ctx context.Context, id string) error {
+	query := "UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL"
+	return execAffectingRow(ctx, r.Db, query, id)
+}
+
+// Purge окончательно удаляет ранее помеченного пользователя
+func (r *PostgresUserRepository) Purge(ctx context.Context, id string) error {
+	query := "DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL"
+	return execAffectingRow(ctx, r.Db, query, id)
+}
+
+// execAffectingRow выполняет запрос и возвращает sql.ErrNoRows, если ни одна строка не изменилась
+func execAffectingRow(ctx context.Context, db *sql.DB, query string, args ...interface{}) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 // List возвращает список пользователей с пагинацией
 func (r *PostgresUserRepository) List(ctx context.Context, limit, offset int) ([]models.User, error) {
-	query := "SELECT id, name, email, deleted_at FROM users WHERE deleted_at IS NULL LIMIT $1 OFFSET $2"
+	query := "SELECT id, username, name, email, role, email_verified_at IS NOT NULL, deleted_at FROM users WHERE deleted_at IS NULL ORDER BY id LIMIT $1 OFFSET $2"
 	rows, err := r.Db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, err
@@ -114,10 +551,10 @@ func (r *PostgresUserRepository) List(ctx context.Context, limit, offset int) ([
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.DeletedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.EmailVerified, &user.DeletedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
 	}
-	return users, nil
+	return users, rows.Err()
 }
@@ -0,0 +1,274 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+// fakeUserRepo хранит пользователей в памяти; err, если задана, возвращается всеми методами
+type fakeUserRepo struct {
+	users map[string]models.User
+	err   error
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: map[string]models.User{}}
+}
+
+func (f *fakeUserRepo) Create(ctx context.Context, user models.User) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	user.ID = len(f.users) + 1
+	user.Password = ""
+	if user.Role == "" {
+		user.Role = models.DefaultRole
+	}
+	f.users[strconv.Itoa(user.ID)] = user
+	return user.ID, nil
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, id string) (models.User, error) {
+	if f.err != nil {
+		return models.User{}, f.err
+	}
+	user, ok := f.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (f *fakeUserRepo) Update(ctx context.Context, user models.User) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.users[strconv.Itoa(user.ID)]; !ok {
+		return sql.ErrNoRows
+	}
+	f.users[strconv.Itoa(user.ID)] = user
+	return nil
+}
+
+func (f *fakeUserRepo) Delete(ctx context.Context, id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.users, id)
+	return nil
+}
+
+func (f *fakeUserRepo) List(ctx context.Context, limit, offset int) ([]models.User, error) {
+	return nil, f.err
+}
+
+func (f *fakeUserRepo) GetByUsername(ctx context.Context, username string) (models.User, error) {
+	return models.User{}, sql.ErrNoRows
+}
+func (f *fakeUserRepo) GetByIDWithDeleted(ctx context.Context, id string) (models.User, error) {
+	return f.GetByID(ctx, id)
+}
+func (f *fakeUserRepo) UpdatePasswordHash(ctx context.Context, id int, hash string) error { return nil }
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, id int, email string) error { return nil }
+func (f *fakeUserRepo) ListByEmail(ctx context.Context, email string) ([]models.User, error) {
+	return nil, nil
+}
+func (f *fakeUserRepo) Restore(ctx context.Context, id string) error { return nil }
+func (f *fakeUserRepo) Purge(ctx context.Context, id string) error   { return nil }
+
+// fakeLoanRepo отдает заданные выдачи и считает запросы, чтобы проверить отсутствие запроса на каждого пользователя
+type fakeLoanRepo struct {
+	loans   []models.Loan
+	queries int
+}
+
+func (f *fakeLoanRepo) OpenLoansByBooks(ctx context.Context, indexes []int) ([]models.Loan, error) {
+	return nil, nil
+}
+func (f *fakeLoanRepo) OpenLoansByUsers(ctx context.Context, userIDs []int) ([]models.Loan, error) {
+	f.queries++
+	return f.loans, nil
+}
+func (f *fakeLoanRepo) HoldsByBooks(ctx context.Context, indexes []int) ([]models.Hold, error) {
+	return nil, nil
+}
+func (f *fakeLoanRepo) HoldsByUsers(ctx context.Context, userIDs []int) ([]models.Hold, error) {
+	f.queries++
+	return nil, nil
+}
+
+func userRouter(repo *fakeUserRepo) http.Handler {
+	return userRouterWithLoans(repo, &fakeLoanRepo{})
+}
+
+func userRouterWithLoans(repo *fakeUserRepo, loans *fakeLoanRepo) http.Handler {
+	uc := &UserController{UserRepo: repo, Loans: loans}
+	r := chi.NewRouter()
+	r.Post("/api/users", uc.CreateUser)
+	r.Get("/api/users", uc.ListUsers)
+	r.Get("/api/users/{id}", uc.GetUser)
+	r.Put("/api/users/{id}", uc.UpdateUser)
+	r.Delete("/api/users/{id}", uc.DeleteUser)
+	return r
+}
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestCreateUserReturnsCreatedResource(t *testing.T) {
+	h := userRouter(newFakeUserRepo())
+	rec := serve(h, http.MethodPost, "/api/users",
+		`{"username":"reader","password":"shelf2024books","name":"Reader","email":"reader@example.com"}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/users/1" {
+		t.Errorf("Location = %q", got)
+	}
+	var user models.User
+	decoder := json.NewDecoder(rec.Body)
+	if err := decoder.Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.More() {
+		t.Error("body must contain a single JSON document")
+	}
+	if user.ID != 1 || user.Username != "reader" || user.Password != "" {
+		t.Errorf("user = %+v", user)
+	}
+}
+
+func TestGetUserDistinguishesMissingFromFailure(t *testing.T) {
+	repo := newFakeUserRepo()
+	h := userRouter(repo)
+
+	if rec := serve(h, http.MethodGet, "/api/users/7", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing user: status = %d, want 404", rec.Code)
+	}
+	if rec := serve(h, http.MethodGet, "/api/users/abc", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want 400", rec.Code)
+	}
+	repo.err = errors.New("connection refused")
+	if rec := serve(h, http.MethodGet, "/api/users/7", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("database failure: status = %d, want 500", rec.Code)
+	}
+}
+
+func TestUpdateUserUsesPathID(t *testing.T) {
+	repo := newFakeUserRepo()
+	repo.users["1"] = models.User{ID: 1, Username: "reader", Name: "Reader", Email: "reader@example.com", Role: "patron"}
+	h := userRouter(repo)
+
+	rec := serve(h, http.MethodPut, "/api/users/1", `{"username":"reader","name":"New Name","email":"reader@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if repo.users["1"].Name != "New Name" {
+		t.Errorf("user was not updated: %+v", repo.users["1"])
+	}
+
+	rec = serve(h, http.MethodPut, "/api/users/1", `{"id":2,"username":"reader","name":"Reader","email":"reader@example.com"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("mismatched id: status = %d, want 400", rec.Code)
+	}
+	rec = serve(h, http.MethodPut, "/api/users/9", `{"username":"reader","name":"Reader","email":"reader@example.com"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing user: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDeleteUserHasNoBody(t *testing.T) {
+	repo := newFakeUserRepo()
+	repo.users["1"] = models.User{ID: 1}
+	h := userRouter(repo)
+
+	rec := serve(h, http.MethodDelete, "/api/users/1", "")
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("status = %d, body = %q; want 204 without body", rec.Code, rec.Body)
+	}
+	if rec := serve(h, http.MethodDelete, "/api/users/1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDeleteUserWithDebtsConflicts(t *testing.T) {
+	repo := newFakeUserRepo()
+	repo.users["1"] = models.User{ID: 1}
+	h := userRouter(repo)
+
+	repo.err = postgres.ErrUserHasOpenLoans
+	if rec := serve(h, http.MethodDelete, "/api/users/1", ""); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), problem.CodeBooksOnLoan) {
+		t.Errorf("open loans: status = %d, body = %s; want 409 %s", rec.Code, rec.Body, problem.CodeBooksOnLoan)
+	}
+	repo.err = postgres.ErrUserHasUnpaidFines
+	if rec := serve(h, http.MethodDelete, "/api/users/1", ""); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), problem.CodeUnpaidFines) {
+		t.Errorf("unpaid fines: status = %d, body = %s; want 409 %s", rec.Code, rec.Body, problem.CodeUnpaidFines)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	h := userRouter(newFakeUserRepo())
+
+	rec := serve(h, http.MethodGet, "/api/users", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("status = %d, body = %q; want 200 with []", rec.Code, rec.Body)
+	}
+	for _, query := range []string{"limit=0", "limit=101", "limit=x", "offset=-1"} {
+		if rec := serve(h, http.MethodGet, "/api/users?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestGetUserSparseFieldsAndIncludes(t *testing.T) {
+	repo := newFakeUserRepo()
+	repo.users["1"] = models.User{ID: 1, Username: "reader", Name: "Reader", Email: "reader@example.com", Role: "patron"}
+	readerID := 1
+	loans := &fakeLoanRepo{loans: []models.Loan{{ID: 5, BookIndex: 3, Book: "Dune", UserID: &readerID, Username: "reader"}}}
+	h := userRouterWithLoans(repo, loans)
+
+	rec := serve(h, http.MethodGet, "/api/users/1?fields=username&include=loans,holds", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	want := `{"username":"reader","loans":[{"id":5,"book_index":3,"book":"Dune","user_id":1,"username":"reader","taken_at":"0001-01-01T00:00:00Z"}],"holds":[]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("body = %s\nwant %s", got, want)
+	}
+	if loans.queries != 2 {
+		t.Errorf("relation queries = %d, want one per relation", loans.queries)
+	}
+
+	rec = serve(h, http.MethodGet, "/api/users/1", "")
+	var plain map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&plain)
+	if _, ok := plain["loans"]; ok || plain["email"] != "reader@example.com" {
+		t.Errorf("without include: %v", plain)
+	}
+
+	for _, query := range []string{"fields=salary", "include=fines"} {
+		if rec := serve(h, http.MethodGet, "/api/users/1?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -12,14 +12,9 @@ type CreateResponse struct {
 	Books   []config.Book `json:"books"` // Добавляем поле для списка книг
 }
 
-type rErrorResponse struct {
-	BadRequest      string `json:"400"`
-	DadataBad       string `json:"500"`
-	SuccefulRequest string `json:"200"`
-}
-
 type UserController struct {
 	UserRepo postgres.UserRepository
+	Loans    postgres.LoanRepository // Выдачи и брони для include=
 }
 
 func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
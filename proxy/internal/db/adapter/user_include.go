@@ -0,0 +1,75 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/fieldset"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+// Связи пользователя, которые можно встроить в ответ через include=
+const (
+	IncludeLoans = "loans"
+	IncludeHolds = "holds"
+)
+
+var userRelations = []string{IncludeLoans, IncludeHolds}
+
+// UserView — пользователь со связями. В ответе остаются только связи из include=; пустая связь — [].
+type UserView struct {
+	models.User
+	Loans []models.Loan `json:"loans"` // Книги, которые сейчас у читателя
+	Holds []models.Hold `json:"holds"`
+}
+
+// userSelection разбирает fields= и include= для пользователей
+func userSelection(r *http.Request) (fieldset.Selection, error) {
+	return fieldset.Parse(r.URL.Query(), fieldset.Names(models.User{}), userRelations)
+}
+
+// embedUsers встраивает в пользователей запрошенные связи: по одному запросу на связь для всего списка
+func (uc *UserController) embedUsers(ctx context.Context, users []models.User, sel fieldset.Selection) ([]UserView, error) {
+	views := make([]UserView, len(users))
+	ids := make([]int, len(users))
+	position := make(map[int]int, len(users))
+	for i, user := range users {
+		views[i].User = user
+		ids[i] = user.ID
+		position[user.ID] = i
+	}
+	if len(users) == 0 {
+		return views, nil
+	}
+
+	if sel.Includes(IncludeLoans) {
+		loans, err := uc.Loans.OpenLoansByUsers(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range views {
+			views[i].Loans = []models.Loan{}
+		}
+		for _, loan := range loans {
+			if loan.UserID == nil {
+				continue
+			}
+			i := position[*loan.UserID]
+			views[i].Loans = append(views[i].Loans, loan)
+		}
+	}
+	if sel.Includes(IncludeHolds) {
+		holds, err := uc.Loans.HoldsByUsers(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range views {
+			views[i].Holds = []models.Hold{}
+		}
+		for _, hold := range holds {
+			i := position[hold.UserID]
+			views[i].Holds = append(views[i].Holds, hold)
+		}
+	}
+	return views, nil
+}
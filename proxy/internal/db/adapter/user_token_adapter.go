@@ -0,0 +1,55 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type PostgresUserTokenRepository struct {
+	Db *sql.DB
+}
+
+func NewPostgresUserTokenRepository(db *sql.DB) *PostgresUserTokenRepository {
+	return &PostgresUserTokenRepository{Db: db}
+}
+
+func (r *PostgresUserTokenRepository) Create(ctx context.Context, token models.UserToken) error {
+	_, err := r.Db.ExecContext(ctx,
+		"INSERT INTO user_tokens (token_hash, user_id, purpose, email, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		token.Hash, token.UserID, token.Purpose, token.Email, token.ExpiresAt)
+	return err
+}
+
+func (r *PostgresUserTokenRepository) Find(ctx context.Context, tokenHash, purpose string) (models.UserToken, error) {
+	token := models.UserToken{Hash: tokenHash, Purpose: purpose}
+	err := r.Db.QueryRowContext(ctx, `
+		SELECT user_id, email, expires_at FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()`, tokenHash, purpose).
+		Scan(&token.UserID, &token.Email, &token.ExpiresAt)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+	return token, nil
+}
+
+// Consume атомарно гасит токен, поэтому одновременные запросы не смогут использовать его дважды
+func (r *PostgresUserTokenRepository) Consume(ctx context.Context, tokenHash, purpose string) (models.UserToken, error) {
+	token := models.UserToken{Hash: tokenHash, Purpose: purpose}
+	err := r.Db.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email, expires_at`, tokenHash, purpose).
+		Scan(&token.UserID, &token.Email, &token.ExpiresAt)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+	return token, nil
+}
+
+func (r *PostgresUserTokenRepository) InvalidateForUser(ctx context.Context, userID int, purpose string) error {
+	_, err := r.Db.ExecContext(ctx,
+		"UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL", userID, purpose)
+	return err
+}
@@ -0,0 +1,173 @@
+// Package fieldset разбирает параметры запроса fields= и include= и оставляет в ответе только запрошенное.
+// fields= перечисляет поля ресурса через запятую, include= — связи, которые нужно встроить в ответ.
+// Без fields= отдаются все поля ресурса, без include= — ни одной связи.
+package fieldset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// Selection — запрошенные поля и связи ресурса
+type Selection struct {
+	Fields    []string // Пусто — все поля
+	Include   []string
+	relations []string
+}
+
+// Parse читает fields= и include= из запроса. fields — поля ресурса, relations — связи, которые
+// умеет встраивать обработчик; неизвестное имя — 400 с кодом invalid_parameter.
+func Parse(query url.Values, fields, relations []string) (Selection, error) {
+	s := Selection{relations: relations}
+	var err error
+	if s.Fields, err = parseList(query, "fields", fields); err != nil {
+		return Selection{}, err
+	}
+	if s.Include, err = parseList(query, "include", relations); err != nil {
+		return Selection{}, err
+	}
+	return s, nil
+}
+
+// parseList разбирает параметр, заданный через запятую или несколько раз; повторы убираются
+func parseList(query url.Values, param string, known []string) ([]string, error) {
+	var names []string
+	for _, value := range query[param] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || contains(names, name) {
+				continue
+			}
+			if !contains(known, name) {
+				return nil, problem.BadRequest(problem.CodeInvalidParameter,
+					fmt.Sprintf("unknown %s value %q, expected one of: %s", param, name, strings.Join(known, ", ")))
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Includes сообщает, запрошена ли связь
+func (s Selection) Includes(relation string) bool {
+	return contains(s.Include, relation)
+}
+
+// Apply оставляет в объекте или в каждом объекте списка запрошенные поля и встроенные связи, сохраняя
+// порядок полей. Связи, которые не запрошены через include=, убираются, даже если поле есть в структуре.
+func (s Selection) Apply(v interface{}) (json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		return s.pick(raw)
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		picked, err := s.pick(item)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(picked)
+	}
+	out.WriteByte(']')
+	return out.Bytes(), nil
+}
+
+// pick оставляет нужные поля одного объекта; значения, которые не являются объектами, не меняются
+func (s Selection) pick(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || raw[0] != '{' {
+		return raw, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		if !s.keep(key) {
+			continue
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+func (s Selection) keep(key string) bool {
+	if contains(s.relations, key) {
+		return s.Includes(key)
+	}
+	return len(s.Fields) == 0 || contains(s.Fields, key)
+}
+
+// Names возвращает JSON имена полей структуры v, включая поля встроенных структур, для списка fields в Parse
+func Names(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			names = append(names, Names(reflect.New(field.Type).Elem().Interface())...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
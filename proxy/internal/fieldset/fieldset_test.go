@@ -0,0 +1,78 @@
+package fieldset
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+type book struct {
+	Index int    `json:"index"`
+	Book  string `json:"book"`
+	Block *bool  `json:"block"`
+}
+
+type bookView struct {
+	book
+	Authors     []string `json:"authors"`
+	CurrentLoan *string  `json:"current_loan"`
+}
+
+var relations = []string{"authors", "current_loan"}
+
+func parse(t *testing.T, query string) Selection {
+	t.Helper()
+	values, _ := url.ParseQuery(query)
+	s, err := Parse(values, Names(book{}), relations)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", query, err)
+	}
+	return s
+}
+
+func TestApply(t *testing.T) {
+	free := true
+	views := []bookView{
+		{book: book{Index: 1, Book: "Dune", Block: &free}, Authors: []string{"Frank Herbert"}},
+		{book: book{Index: 2, Book: "Solaris"}, Authors: []string{"Stanislaw Lem"}},
+	}
+	cases := map[string]string{
+		"":                                  `[{"index":1,"book":"Dune","block":true},{"index":2,"book":"Solaris","block":null}]`,
+		"fields=book,block":                 `[{"book":"Dune","block":true},{"book":"Solaris","block":null}]`,
+		"fields=block&fields=book":          `[{"book":"Dune","block":true},{"book":"Solaris","block":null}]`,
+		"fields=book&include=authors":       `[{"book":"Dune","authors":["Frank Herbert"]},{"book":"Solaris","authors":["Stanislaw Lem"]}]`,
+		"include=current_loan&fields=index": `[{"index":1,"current_loan":null},{"index":2,"current_loan":null}]`,
+	}
+	for query, want := range cases {
+		got, err := parse(t, query).Apply(views)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if string(got) != want {
+			t.Errorf("%q: got %s, want %s", query, got, want)
+		}
+	}
+
+	got, _ := parse(t, "fields=book").Apply(views[0])
+	if string(got) != `{"book":"Dune"}` {
+		t.Errorf("single object: got %s", got)
+	}
+	got, _ = parse(t, "fields=book").Apply([]bookView{})
+	if string(got) != `[]` {
+		t.Errorf("empty list: got %s", got)
+	}
+}
+
+func TestParseRejectsUnknownNames(t *testing.T) {
+	for _, query := range []string{"fields=title", "include=holds", "fields=authors"} {
+		values, _ := url.ParseQuery(query)
+		_, err := Parse(values, Names(book{}), relations)
+		var p *problem.Problem
+		if !errors.As(err, &p) || p.Status != http.StatusBadRequest || p.Code != problem.CodeInvalidParameter {
+			t.Errorf("%q: expected 400 invalid_parameter, got %v", query, err)
+		}
+	}
+}
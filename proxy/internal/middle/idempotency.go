@@ -0,0 +1,172 @@
+package middle
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed" // true в ответе, взятом из сохраненных
+	maxIdempotencyKeyLength  = 255
+	// idempotencyLeaseMargin — запас сверх срока запроса на сохранение ответа после его отправки
+	idempotencyLeaseMargin = 10 * time.Second
+)
+
+// IdempotencyStore хранит первые ответы на запросы с Idempotency-Key, см. postgres.IdempotencyRepository
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record models.IdempotencyRecord) error
+	Release(ctx context.Context, scope, key string) error
+}
+
+// Idempotency сохраняет на ttl первый ответ на запрос с заголовком Idempotency-Key и отдает его на повторы
+// того же пользователя с тем же ключом. Повтор с другим методом, путем или телом получает 422, повтор до
+// завершения первого запроса — 409. Ответы 5xx не сохраняются, а после 5xx или паники обработчика ключ
+// освобождается, чтобы запрос можно было повторить. Запросы без заголовка проходят как обычно.
+// Запрос, занявший ключ, выполняется с контекстом со сроком timeout; ключ удерживается чуть дольше,
+// поэтому повтор займет его, только если первый запрос уже прерван. Ставится после проверки токена.
+func Idempotency(resp controller.Responder, store IdempotencyStore, ttl, timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				resp.Error(w, r, problem.BadRequest(problem.CodeInvalidParameter, "Idempotency-Key must be at most 255 characters"))
+				return
+			}
+			identity, ok := service.FromContext(r.Context())
+			if !ok {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				// Ошибку чтения, например превышение размера тела, описывает обработчик
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), failingReader{err}))
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+			hash.Write(body)
+			record := models.IdempotencyRecord{
+				Scope:       "user:" + identity.UserID,
+				Key:         key,
+				RequestHash: hex.EncodeToString(hash.Sum(nil)),
+				ExpiresAt:   time.Now().Add(ttl),
+				Lease:       timeout + idempotencyLeaseMargin,
+			}
+
+			saved, reserved, err := store.Reserve(r.Context(), record)
+			if err != nil {
+				resp.Error(w, r, err)
+				return
+			}
+			if !reserved {
+				switch {
+				case saved.RequestHash != record.RequestHash:
+					resp.Error(w, r, problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused,
+						"Idempotency-Key was already used for a different request"))
+				case saved.Status == 0:
+					resp.Error(w, r, problem.Conflict(problem.CodeIdempotencyKeyInUse,
+						"a request with this Idempotency-Key is still in progress"))
+				default:
+					replay(w, saved)
+				}
+				return
+			}
+
+			defer func() {
+				if p := recover(); p != nil {
+					if err := store.Release(context.WithoutCancel(r.Context()), record.Scope, record.Key); err != nil {
+						log.Printf("Error releasing Idempotency-Key for %s %s: %v", r.Method, r.URL.Path, err)
+					}
+					panic(p)
+				}
+			}()
+
+			// Обработчик должен уложиться в срок удержания ключа: по истечении timeout его запросы к базе прерываются
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			recorded := &recordingResponse{ResponseWriter: w}
+			next.ServeHTTP(recorded, r)
+			if recorded.status == 0 {
+				recorded.status = http.StatusOK
+			}
+
+			// Ответ уже отправлен; сохраняем его, даже если клиент успел отключиться или срок запроса истек
+			ctx = context.WithoutCancel(r.Context())
+			if recorded.status >= http.StatusInternalServerError {
+				err = store.Release(ctx, record.Scope, record.Key)
+			} else {
+				record.Status = recorded.status
+				record.ContentType = w.Header().Get("Content-Type")
+				record.Location = w.Header().Get("Location")
+				record.Body = recorded.body.Bytes()
+				err = store.Complete(ctx, record)
+			}
+			if err != nil {
+				log.Printf("Error saving idempotent response for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// replay повторяет сохраненный ответ
+func replay(w http.ResponseWriter, saved models.IdempotencyRecord) {
+	if saved.ContentType != "" {
+		w.Header().Set("Content-Type", saved.ContentType)
+	}
+	if saved.Location != "" {
+		w.Header().Set("Location", saved.Location)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(saved.Status)
+	w.Write(saved.Body)
+}
+
+// recordingResponse передает ответ клиенту и запоминает статус и тело
+type recordingResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *recordingResponse) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *recordingResponse) Write(p []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(p)
+	return rr.ResponseWriter.Write(p)
+}
+
+type failingReader struct{ err error }
+
+func (f failingReader) Read([]byte) (int, error) { return 0, f.err }
@@ -0,0 +1,141 @@
+package middle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+// memoryIdempotency хранит записи в памяти, без учета срока
+type memoryIdempotency map[string]models.IdempotencyRecord
+
+func (m memoryIdempotency) Reserve(ctx context.Context, record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	if saved, ok := m[record.Scope+"/"+record.Key]; ok {
+		return saved, false, nil
+	}
+	m[record.Scope+"/"+record.Key] = record
+	return record, true, nil
+}
+
+func (m memoryIdempotency) Complete(ctx context.Context, record models.IdempotencyRecord) error {
+	m[record.Scope+"/"+record.Key] = record
+	return nil
+}
+
+func (m memoryIdempotency) Release(ctx context.Context, scope, key string) error {
+	delete(m, scope+"/"+key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	status := http.StatusCreated
+	store := memoryIdempotency{}
+	handler := Idempotency(controller.NewResponder(zap.NewNop()), store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Location", "/api/v2/books/1/loan")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(int(n)) + `}`))
+	}))
+
+	send := func(userID, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/books/1/loan", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req = req.WithContext(service.NewContext(req.Context(), service.Identity{UserID: userID}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("7", "k1", `{}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"call":1}` {
+		t.Fatalf("first request: %d %s", first.Code, first.Body)
+	}
+
+	replayed := send("7", "k1", `{}`)
+	if replayed.Code != http.StatusCreated || replayed.Body.String() != `{"call":1}` || calls != 1 {
+		t.Errorf("Expected replay of the first response, got %d %s after %d calls", replayed.Code, replayed.Body, calls)
+	}
+	if replayed.Header().Get(IdempotentReplayedHeader) != "true" || replayed.Header().Get("Location") != "/api/v2/books/1/loan" {
+		t.Errorf("Replay headers = %v", replayed.Header())
+	}
+
+	if rr := send("7", "k1", `{"username":"other"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected %d for a different payload, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if rr := send("8", "k1", `{}`); rr.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("Expected keys of other users to be independent, got %d after %d calls", rr.Code, calls)
+	}
+	if rr := send("7", "", `{}`); rr.Code != http.StatusCreated || calls != 3 {
+		t.Errorf("Expected request without a key to run, got %d after %d calls", rr.Code, calls)
+	}
+
+	store["user:7/pending"] = models.IdempotencyRecord{Scope: "user:7", Key: "pending", RequestHash: store["user:7/k1"].RequestHash}
+	if rr := send("7", "pending", `{}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected %d while the first request runs, got %d", http.StatusConflict, rr.Code)
+	}
+
+	status = http.StatusInternalServerError
+	send("7", "k2", `{}`)
+	if _, ok := store["user:7/k2"]; ok {
+		t.Errorf("Expected key to be released after a server error")
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	store := memoryIdempotency{}
+	handler := Idempotency(controller.NewResponder(zap.NewNop()), store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/books/1/loan", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	req = req.WithContext(service.NewContext(req.Context(), service.Identity{UserID: "7"}))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic to reach the caller")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	if _, ok := store["user:7/k1"]; ok {
+		t.Error("Expected key to be released after a panic")
+	}
+}
+
+func TestIdempotencyBoundsHandlerByLease(t *testing.T) {
+	store := memoryIdempotency{}
+	var deadline time.Time
+	handler := Idempotency(controller.NewResponder(zap.NewNop()), store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if deadline, ok = r.Context().Deadline(); !ok {
+			t.Error("Expected handler context to have a deadline")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/books/1/loan", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	req = req.WithContext(service.NewContext(req.Context(), service.Identity{UserID: "7"}))
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lease := store["user:7/k1"].Lease
+	if lease <= time.Minute || start.Add(lease).Before(deadline) {
+		t.Errorf("Expected key to be held past the handler deadline %v, lease %v", deadline.Sub(start), lease)
+	}
+}
@@ -1,31 +1,238 @@
 package middle
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi"
+	"github.com/go-chi/jwtauth"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
 )
 
-func TokenAuthMiddleware(resp controller.Responder) func(http.Handler) http.Handler {
+// RevocationChecker сообщает, отозвана ли сессия, в которой выдан токен
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// APIKeyAuthenticator определяет пользователя и области по API ключу
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (service.Identity, error)
+}
+
+// TokenAuthMiddleware принимает JWT или API ключ: "Authorization: Bearer <jwt|glk_...>" либо "X-API-Key: glk_..."
+func TokenAuthMiddleware(resp controller.Responder, revocations RevocationChecker, apiKeys APIKeyAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := r.Header.Get("Authorization")
-			if token == "" {
-				resp.ErrorUnauthorized(w, errors.New("missing authorization token"))
+			header := r.Header.Get("Authorization")
+			if key := r.Header.Get("X-API-Key"); key != "" && header == "" {
+				header = "Bearer " + key
+			}
+			if header == "" {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "missing authorization token"))
+				return
+			}
+
+			token := strings.TrimPrefix(header, "Bearer ")
+			if token == header {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authorization header must use the Bearer scheme"))
+				return
+			}
+
+			if service.IsAPIKey(token) {
+				identity, err := apiKeys.Authenticate(r.Context(), token)
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					resp.Error(w, r, problem.Unauthorized(problem.CodeInvalidToken, err.Error()))
+					return
+				}
+				if err != nil {
+					resp.Error(w, r, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(service.NewContext(r.Context(), identity)))
+				return
+			}
+
+			// Verify проверяет подпись, срок действия, издателя и аудиторию токена
+			jwtToken, err := service.TokenAuth.Verify(token)
+			if err != nil {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeInvalidToken, err.Error()))
 				return
 			}
 
-			token = strings.TrimPrefix(token, "Bearer ")
+			userID, _ := jwtToken.Get("user_id")
+			username, _ := jwtToken.Get("username")
+			role, _ := jwtToken.Get("role")
+			sessionID, _ := jwtToken.Get("sid")
+			identity := service.Identity{}
+			identity.UserID, _ = userID.(string)
+			identity.Username, _ = username.(string)
+			identity.Role, _ = role.(string)
+			identity.SessionID, _ = sessionID.(string)
+			mfa, _ := jwtToken.Get("mfa")
+			identity.MFA, _ = mfa.(bool)
+			if identity.UserID == "" || identity.SessionID == "" {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeInvalidToken, "token has no user_id or sid claim"))
+				return
+			}
 
-			_, err := service.TokenAuth.Decode(token)
+			revoked, err := revocations.IsRevoked(r.Context(), identity.SessionID)
 			if err != nil {
-				resp.ErrorUnauthorized(w, err)
+				resp.Error(w, r, err)
+				return
+			}
+			if revoked {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeInvalidToken, "token has been revoked"))
+				return
+			}
+
+			ctx := jwtauth.NewContext(r.Context(), jwtToken, nil)
+			ctx = service.NewContext(ctx, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RealIP заменяет RemoteAddr адресом клиента из X-Forwarded-For или X-Real-IP, но только если запрос пришел
+// от доверенного прокси. В X-Forwarded-For берется крайний справа адрес, который не принадлежит доверенным
+// прокси: адреса левее мог дописать сам клиент. От остальных отправителей заголовки не принимаются,
+// иначе клиент мог бы обходить ограничение попыток входа по IP и подменять адрес в журнале аудита.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			return false
+		}
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil || !isTrusted(host) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := ""
+			hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if net.ParseIP(hop) == nil {
+					break
+				}
+				client = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			if client == "" {
+				if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+					client = ip.String()
+				}
+			}
+			if client != "" {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Optional применяет mw только к запросам с учетными данными (Authorization или X-API-Key), остальные
+// проходят без пользователя в контексте. Для публичных маршрутов, которые вошедшему отдают больше.
+func Optional(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		guarded := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			guarded.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission пропускает запрос, только если роль пользователя дает хотя бы одно из прав
+func RequirePermission(resp controller.Responder, perms ...service.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := service.FromContext(r.Context())
+			if !ok {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
 				return
 			}
+			for _, perm := range perms {
+				if identity.Can(perm) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			resp.Error(w, r, problem.Forbidden(problem.CodeForbidden, "insufficient permissions"))
+		})
+	}
+}
 
+// RequireSelfOrPermission пропускает запрос к собственной учетной записи (по параметру маршрута param)
+// или пользователя, у которого есть право perm. API ключ доступа к учетной записи владельца не дает.
+func RequireSelfOrPermission(resp controller.Responder, param string, perm service.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := service.FromContext(r.Context())
+			if !ok {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
+				return
+			}
+			if (identity.UserID == chi.URLParam(r, param) && identity.APIKeyID == 0) || identity.Can(perm) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			resp.Error(w, r, problem.Forbidden(problem.CodeForbidden, "insufficient permissions"))
+		})
+	}
+}
+
+// RequireMFA не пропускает пользователей, чья роль по политике требует второго фактора,
+// если вход выполнен без него. API ключ проходит, только если выпущен из сессии со вторым фактором.
+func RequireMFA(resp controller.Responder, policy service.MFAPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := service.FromContext(r.Context())
+			if !ok {
+				resp.Error(w, r, problem.Unauthorized(problem.CodeUnauthorized, "authentication required"))
+				return
+			}
+			if !policy.Satisfied(identity) {
+				resp.Error(w, r, problem.Forbidden(problem.CodeMFARequired, "multi-factor authentication is required for your role: enroll at /api/mfa/totp and log in again"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deprecated помечает ответы устаревшей версии API: Deprecation (RFC 9745) с датой объявления,
+// Sunset (RFC 8594) с датой отключения и Link на версию, которой ее заменили
+func Deprecated(deprecatedAt, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+	link := "<" + successor + `>; rel="successor-version"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", link)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -0,0 +1,240 @@
+package middle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+type revokedSessions map[string]bool
+
+func (s revokedSessions) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return s[sessionID], nil
+}
+
+type staticAPIKeys map[string]service.Identity
+
+func (k staticAPIKeys) Authenticate(ctx context.Context, key string) (service.Identity, error) {
+	identity, ok := k[key]
+	if !ok {
+		return service.Identity{}, service.ErrInvalidAPIKey
+	}
+	return identity, nil
+}
+
+func TestTokenAuthMiddleware(t *testing.T) {
+	var identity service.Identity
+	revocations := revokedSessions{"old-session": true}
+	handler := TokenAuthMiddleware(controller.NewResponder(zap.NewNop()), revocations, staticAPIKeys{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = service.FromContext(r.Context())
+	}))
+
+	_, valid, _ := service.TokenAuth.Encode(map[string]interface{}{
+		"user_id":  "7",
+		"username": "reader",
+		"sid":      "session",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	})
+	_, expired, _ := service.TokenAuth.Encode(map[string]interface{}{
+		"user_id": "7",
+		"sid":     "session",
+		"exp":     time.Now().Add(-time.Hour).Unix(),
+	})
+	_, noUser, _ := service.TokenAuth.Encode(map[string]interface{}{
+		"sid": "session",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, revoked, _ := service.TokenAuth.Encode(map[string]interface{}{
+		"user_id": "7",
+		"sid":     "old-session",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+
+	cases := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic " + valid, http.StatusUnauthorized},
+		{"garbage", "Bearer garbage", http.StatusUnauthorized},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized},
+		{"no user_id", "Bearer " + noUser, http.StatusUnauthorized},
+		{"revoked session", "Bearer " + revoked, http.StatusUnauthorized},
+		{"valid", "Bearer " + valid, http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, rr.Code)
+			}
+		})
+	}
+
+	if identity.UserID != "7" || identity.Username != "reader" || identity.SessionID != "session" {
+		t.Errorf("Expected identity 7/reader, got %+v", identity)
+	}
+}
+
+func TestTokenAuthMiddlewareAPIKey(t *testing.T) {
+	var identity service.Identity
+	apiKeys := staticAPIKeys{"glk_kiosk": {UserID: "3", Role: "librarian", APIKeyID: 9, Scopes: []service.Permission{service.PermLoansOnBehalf}}}
+	handler := TokenAuthMiddleware(controller.NewResponder(zap.NewNop()), revokedSessions{}, apiKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = service.FromContext(r.Context())
+	}))
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"bearer key", "Authorization", "Bearer glk_kiosk", http.StatusOK},
+		{"header key", "X-API-Key", "glk_kiosk", http.StatusOK},
+		{"unknown key", "X-API-Key", "glk_unknown", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			identity = service.Identity{}
+			req := httptest.NewRequest(http.MethodPost, "/api/book/take/1", nil)
+			req.Header.Set(c.header, c.value)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != c.status {
+				t.Errorf("Expected status %d, got %d", c.status, rr.Code)
+			}
+			if c.status == http.StatusOK && identity.APIKeyID != 9 {
+				t.Errorf("Expected API key identity, got %+v", identity)
+			}
+		})
+	}
+
+	// Области ключа сужают права роли
+	if identity := apiKeys["glk_kiosk"]; identity.Can(service.PermBooksWrite) || !identity.Can(service.PermLoansOnBehalf) {
+		t.Errorf("Expected key to be limited to its scopes")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	resp := controller.NewResponder(zap.NewNop())
+	handler := RequirePermission(resp, service.PermBooksWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := map[string]int{
+		"patron":    http.StatusForbidden,
+		"librarian": http.StatusOK,
+		"admin":     http.StatusOK,
+		"":          http.StatusForbidden,
+	}
+	for role, status := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/book", nil)
+		req = req.WithContext(service.NewContext(req.Context(), service.Identity{UserID: "1", Role: role}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Errorf("role %q: expected status %d, got %d", role, status, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/book", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without identity, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	resp := controller.NewResponder(zap.NewNop())
+	apiKeys := staticAPIKeys{"glk_kiosk": {UserID: "3", Role: "librarian", APIKeyID: 9}}
+	handler := Optional(TokenAuthMiddleware(resp, revokedSessions{}, apiKeys))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := service.FromContext(r.Context())
+		w.Write([]byte(identity.UserID))
+	}))
+
+	cases := []struct {
+		header, value string
+		status        int
+		userID        string
+	}{
+		{"", "", http.StatusOK, ""},
+		{"X-API-Key", "glk_kiosk", http.StatusOK, "3"},
+		{"X-API-Key", "glk_unknown", http.StatusUnauthorized, ""},
+		{"Authorization", "Basic YWRtaW46YWRtaW4=", http.StatusUnauthorized, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/books", nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != c.status || (c.status == http.StatusOK && rr.Body.String() != c.userID) {
+			t.Errorf("%s %q: expected %d %q, got %d %q", c.header, c.value, c.status, c.userID, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("172.16.0.0/12")
+	handler := RealIP([]*net.IPNet{proxies})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(host))
+	}))
+
+	cases := []struct {
+		remote, forwarded, realIP, want string
+	}{
+		{"203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"}, // Клиент без прокси не выбирает адрес
+		{"172.18.0.5:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"172.18.0.5:5000", "10.9.9.9, 198.51.100.1", "", "198.51.100.1"}, // Левый адрес дописал клиент
+		{"172.18.0.5:5000", "198.51.100.1, 172.18.0.9", "", "198.51.100.1"},
+		{"172.18.0.5:5000", "", "198.51.100.2", "198.51.100.2"},
+		{"172.18.0.5:5000", "", "", "172.18.0.5"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if c.realIP != "" {
+			req.Header.Set("X-Real-IP", c.realIP)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Body.String() != c.want {
+			t.Errorf("%s via %q/%q: expected %s, got %s", c.remote, c.forwarded, c.realIP, c.want, rr.Body)
+		}
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	deprecatedAt := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+	handler := Deprecated(deprecatedAt, sunset, "/api/v2")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/books", nil))
+
+	if got := rr.Header().Get("Deprecation"); got != "@1792368000" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got := rr.Header().Get("Sunset"); got != "Fri, 30 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q", got)
+	}
+	if got := rr.Header().Get("Link"); got != `</api/v2>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// APIKey — долгоживущий ключ для интеграций и киосков самообслуживания
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Начало ключа, по которому его можно узнать в списке
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	MFA        bool       `json:"mfa"` // Выпущен из сессии, вход в которую подтвержден вторым фактором
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// События журнала безопасности
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditIPLocked        = "ip_locked"
+	AuditAccountUnlocked = "account_unlocked"
+)
+
+// AuditEntry — запись журнала событий безопасности
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	Event     string    `json:"event"`
+	ActorID   *int      `json:"actor_id,omitempty"` // Пользователь, выполнивший действие; nil для системных событий
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyRecord — первый ответ на запрос с заголовком Idempotency-Key. Пока запрос
+// выполняется, Status равен нулю, а повторы с тем же ключом получают 409.
+type IdempotencyRecord struct {
+	Scope       string // Владелец ключа, например "user:7"; ключи разных пользователей не пересекаются
+	Key         string
+	RequestHash string // SHA-256 метода, пути и тела запроса
+	Status      int
+	ContentType string
+	Location    string
+	Body        []byte
+	ExpiresAt   time.Time
+	Lease       time.Duration // Сколько незавершенная запись держит ключ; потом его может занять повтор
+}
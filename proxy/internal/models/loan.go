@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Loan — книга, которая сейчас у читателя
+type Loan struct {
+	ID        int       `json:"id"`
+	BookIndex int       `json:"book_index"`
+	Book      string    `json:"book"`     // Название книги
+	UserID    *int      `json:"user_id"`  // nil, если читатель удален окончательно
+	Username  string    `json:"username"` // Пусто, если читатель удален окончательно
+	TakenAt   time.Time `json:"taken_at"`
+}
+
+// Hold — бронь книги: читатель стоит в очереди на нее
+type Hold struct {
+	ID        int       `json:"id"`
+	BookIndex int       `json:"book_index"`
+	Book      string    `json:"book"` // Название книги
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Position  int       `json:"position"` // Место в очереди на книгу, с 1
+	CreatedAt time.Time `json:"created_at"`
+}
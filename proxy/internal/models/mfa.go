@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MFA — настройки второго фактора (TOTP) пользователя
+type MFA struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time // nil, пока пользователь не подтвердил подключение кодом
+	LastUsedStep int64      // Шаг последнего принятого кода, защищает от повторного использования
+}
+
+// Enabled сообщает, что второй фактор подключен и обязателен при входе
+func (m MFA) Enabled() bool {
+	return m.ConfirmedAt != nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session представляет вход пользователя с конкретного устройства
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	MFA        bool       `json:"mfa"` // Вход подтвержден вторым фактором
+}
@@ -5,9 +5,33 @@ import (
 )
 
 type User struct {
-	ID        int                 `json:"id"`
-	Name      string              `json:"name"`
-	Email     string              `json:"email"`
-	DeletedAt *string             `json:"deleted_at"` // Для логического удаления
-	Books     map[int]config.Book `json:"books"`
+	ID            int                 `json:"id"`
+	Username      string              `json:"username" validate:"required,max=50"`
+	Password      string              `json:"password,omitempty"` // Открытый пароль, принимается только при создании
+	PasswordHash  string              `json:"-"`
+	Name          string              `json:"name" validate:"required,max=50"`
+	Email         string              `json:"email" validate:"required,max=255,email"`
+	Role          string              `json:"role" validate:"oneof=patron librarian admin"`
+	EmailVerified bool                `json:"email_verified"`
+	DeletedAt     *string             `json:"deleted_at"` // Для логического удаления
+	Books         map[int]config.Book `json:"books"`
+
+	MustChangePassword bool `json:"-"` // Пароль задан при развертывании и заменяется при первом входе
+}
+
+const (
+	RolePatron    = "patron"    // Читатель: берет и возвращает свои книги
+	RoleLibrarian = "librarian" // Библиотекарь: ведет каталог и выдает книги читателям
+	RoleAdmin     = "admin"     // Администратор: управляет пользователями
+
+	DefaultRole = RolePatron
+)
+
+// ValidRole проверяет, что роль известна системе
+func ValidRole(role string) bool {
+	switch role {
+	case RolePatron, RoleLibrarian, RoleAdmin:
+		return true
+	}
+	return false
 }
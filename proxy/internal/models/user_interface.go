@@ -3,8 +3,8 @@ package models
 // User представляет собой модель пользователя
 
 type AddaderBook struct {
-	Book   string `json:"book"`
-	Author string `json:"author"`
+	Book   string `json:"book" validate:"required,max=50"`
+	Author string `json:"author" validate:"required,max=255"`
 }
 
 // UserRepository определяет методы для работы с пользователями
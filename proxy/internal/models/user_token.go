@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Назначения одноразовых токенов
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken — одноразовый токен из письма; в базе хранится только его хеш
+type UserToken struct {
+	Hash      string
+	UserID    int
+	Purpose   string
+	Email     string // Адрес, на который отправлено письмо
+	ExpiresAt time.Time
+}
@@ -0,0 +1,308 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+)
+
+// Допустимое расхождение часов с провайдером
+const clockSkew = time.Minute
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Алгоритмы подписи ID токена, которые мы принимаем; симметричные и "none" запрещены
+var allowedAlgorithms = map[jwa.SignatureAlgorithm]bool{
+	jwa.RS256: true, jwa.RS384: true, jwa.RS512: true,
+	jwa.PS256: true, jwa.PS384: true, jwa.PS512: true,
+	jwa.ES256: true, jwa.ES384: true, jwa.ES512: true,
+	jwa.EdDSA: true,
+}
+
+// Discovery — нужная нам часть документа /.well-known/openid-configuration
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims — сведения о пользователе из ID токена
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Groups            []string
+	AMR               []string // Способы аутентификации у провайдера (RFC 8176)
+}
+
+// HasMFA сообщает, что провайдер подтвердил вход вторым фактором
+func (c Claims) HasMFA() bool {
+	for _, method := range c.AMR {
+		switch method {
+		case "mfa", "otp", "hwk", "swk":
+			return true
+		}
+	}
+	return false
+}
+
+// Client выполняет вход по authorization code с PKCE у одного провайдера
+type Client struct {
+	cfg       config.OIDCConfig
+	discovery Discovery
+	http      *http.Client
+
+	mu        sync.Mutex
+	keys      jwk.Set
+	fetchedAt time.Time
+}
+
+// NewClient читает документ discovery провайдера и проверяет, что он описывает ожидаемого издателя
+func NewClient(ctx context.Context, cfg config.OIDCConfig, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC issuer, client ID and redirect URL are required")
+	}
+
+	wellKnown := strings.TrimRight(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned %s", resp.Status)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("decoding discovery document: %w", err)
+	}
+	if discovery.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, cfg.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	return &Client{cfg: cfg, discovery: discovery, http: httpClient}, nil
+}
+
+// Issuer возвращает идентификатор провайдера, которым подписаны его ID токены
+func (c *Client) Issuer() string {
+	return c.cfg.Issuer
+}
+
+// RandomString возвращает случайную строку для state, nonce и PKCE verifier
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Challenge вычисляет PKCE code_challenge методом S256
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL возвращает адрес, на который нужно отправить пользователя для входа
+func (c *Client) AuthCodeURL(state, nonce, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(c.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return c.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange обменивает код авторизации на ID токен
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if c.cfg.ClientSecret == "" {
+		form.Set("client_id", c.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken проверяет подпись ID токена ключами провайдера, а также iss, aud, azp, exp и nonce
+func (c *Client) VerifyIDToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	msg, err := jws.ParseString(raw)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return Claims{}, ErrInvalidIDToken
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	if !allowedAlgorithms[headers.Algorithm()] {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	key, err := c.key(ctx, headers.KeyID())
+	if err != nil {
+		return Claims{}, err
+	}
+	var rawKey interface{}
+	if err := key.Raw(&rawKey); err != nil {
+		return Claims{}, err
+	}
+	token, err := jwt.ParseString(raw, jwt.WithVerify(headers.Algorithm(), rawKey))
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	if token.Expiration().IsZero() || token.Issuer() != c.cfg.Issuer {
+		return Claims{}, ErrInvalidIDToken
+	}
+	err = jwt.Validate(token,
+		jwt.WithAcceptableSkew(clockSkew),
+		jwt.WithIssuer(c.cfg.Issuer),
+		jwt.WithAudience(c.cfg.ClientID))
+	if err != nil {
+		return Claims{}, err
+	}
+	if aud := token.Audience(); len(aud) > 1 {
+		if azp, _ := token.Get("azp"); azp != c.cfg.ClientID {
+			return Claims{}, errors.New("azp not satisfied")
+		}
+	}
+	if got, _ := token.Get("nonce"); got != nonce || nonce == "" {
+		return Claims{}, errors.New("nonce not satisfied")
+	}
+	if token.Subject() == "" {
+		return Claims{}, errors.New("ID token has no subject")
+	}
+
+	claims := Claims{Subject: token.Subject()}
+	claims.Email = stringClaim(token, "email")
+	claims.PreferredUsername = stringClaim(token, "preferred_username")
+	claims.Name = stringClaim(token, "name")
+	if verified, ok := token.Get("email_verified"); ok {
+		claims.EmailVerified, _ = verified.(bool)
+	}
+	claims.Groups = stringListClaim(token, c.cfg.GroupsClaim)
+	claims.AMR = stringListClaim(token, "amr")
+	return claims, nil
+}
+
+func stringListClaim(token jwt.Token, name string) []string {
+	value, _ := token.Get(name)
+	list, _ := value.([]interface{})
+	var result []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func stringClaim(token jwt.Token, name string) string {
+	value, _ := token.Get(name)
+	s, _ := value.(string)
+	return s
+}
+
+// key ищет ключ провайдера по kid; неизвестный kid означает смену ключей,
+// поэтому набор перечитывается, но не чаще раза в минуту
+func (c *Client) key(ctx context.Context, kid string) (jwk.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keys != nil {
+		if key, ok := lookupKey(c.keys, kid); ok {
+			return key, nil
+		}
+		if time.Since(c.fetchedAt) < time.Minute {
+			return nil, errors.New("unknown ID token signing key")
+		}
+	}
+
+	keys, err := jwk.Fetch(ctx, c.discovery.JWKSURI, jwk.WithHTTPClient(c.http))
+	if err != nil {
+		return nil, fmt.Errorf("fetching provider keys: %w", err)
+	}
+	c.keys, c.fetchedAt = keys, time.Now()
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown ID token signing key")
+}
+
+func lookupKey(keys jwk.Set, kid string) (jwk.Key, bool) {
+	if kid == "" {
+		// Без kid ключ однозначен, только если он единственный
+		if keys.Len() != 1 {
+			return nil, false
+		}
+		return keys.Get(0)
+	}
+	return keys.LookupKeyID(kid)
+}
@@ -0,0 +1,99 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/oidc/oidctest"
+)
+
+// authorize проходит вход у провайдера и возвращает код и state из редиректа
+func authorize(t *testing.T, authURL string) (code, state string) {
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorize request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect from provider, got %s", resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider := oidctest.NewProvider("library", "secret")
+	defer provider.Close()
+	provider.SetClaims(map[string]interface{}{
+		"sub":                "u-42",
+		"email":              "reader@university.example",
+		"email_verified":     true,
+		"preferred_username": "reader",
+		"groups":             []string{"students", "library-staff"},
+	})
+
+	ctx := context.Background()
+	client, err := NewClient(ctx, config.OIDCConfig{
+		Issuer:       provider.Issuer,
+		ClientID:     "library",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/oidc/callback",
+		GroupsClaim:  "groups",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Expected discovery to succeed, got %v", err)
+	}
+
+	verifier, _ := RandomString()
+	code, state := authorize(t, client.AuthCodeURL("state-1", "nonce-1", verifier))
+	if state != "state-1" {
+		t.Errorf("Expected state to round-trip, got %q", state)
+	}
+
+	if _, err := client.Exchange(ctx, code, "wrong verifier"); err == nil {
+		t.Error("Expected exchange with a wrong PKCE verifier to fail")
+	}
+
+	code, _ = authorize(t, client.AuthCodeURL("state-2", "nonce-2", verifier))
+	idToken, err := client.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Expected exchange to succeed, got %v", err)
+	}
+	if _, err := client.Exchange(ctx, code, verifier); err == nil {
+		t.Error("Expected a code to be usable only once")
+	}
+
+	if _, err := client.VerifyIDToken(ctx, idToken, "nonce-1"); err == nil {
+		t.Error("Expected nonce mismatch to be rejected")
+	}
+	claims, err := client.VerifyIDToken(ctx, idToken, "nonce-2")
+	if err != nil {
+		t.Fatalf("Expected ID token to be valid, got %v", err)
+	}
+	if claims.Subject != "u-42" || claims.PreferredUsername != "reader" || !claims.EmailVerified || len(claims.Groups) != 2 {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+}
+
+func TestNewClientRejectsIssuerMismatch(t *testing.T) {
+	provider := oidctest.NewProvider("library", "")
+	defer provider.Close()
+
+	_, err := NewClient(context.Background(), config.OIDCConfig{
+		Issuer:      provider.Issuer + "/",
+		ClientID:    "library",
+		RedirectURL: "http://localhost/api/oidc/callback",
+	}, nil)
+	if err == nil {
+		t.Error("Expected issuer mismatch to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Params задает параметры хеширования argon2id
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams соответствуют рекомендациям RFC 9106; при их изменении
+// хеши пересчитываются при следующем успешном входе пользователя
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const (
+	MinLength = 10
+	MaxLength = 128
+)
+
+var (
+	ErrInvalidHash         = errors.New("invalid password hash")
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+)
+
+var commonPasswords = map[string]struct{}{
+	"password123": {}, "1234567890": {}, "qwertyuiop": {}, "1q2w3e4r5t": {},
+	"password1!": {}, "iloveyou12": {}, "admin12345": {}, "letmein123": {},
+}
+
+// Hash вычисляет хеш пароля в формате PHC: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func Hash(plain string) (string, error) {
+	p := DefaultParams
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify сравнивает пароль с сохраненным хешем за постоянное время.
+// needsRehash сообщает, что хеш устарел и его стоит пересчитать с DefaultParams.
+// Поддерживаются argon2id, bcrypt и пароли, сохраненные до введения хеширования.
+func Verify(plain, encoded string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(plain, encoded)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	case strings.HasPrefix(encoded, "$"), encoded == "":
+		return false, false, ErrInvalidHash
+	default:
+		// Открытый пароль из старой схемы хранения
+		ok := subtle.ConstantTimeCompare([]byte(plain), []byte(encoded)) == 1
+		return ok, ok, nil
+	}
+}
+
+func verifyArgon2id(plain, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return false, false, ErrIncompatibleVersion
+	}
+
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	candidate := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return false, false, nil
+	}
+	return true, p != DefaultParams, nil
+}
+
+// Validate проверяет пароль на соответствие требованиям к сложности
+func Validate(plain, username string) error {
+	length := utf8.RuneCountInString(plain)
+	if length < MinLength {
+		return fmt.Errorf("password must be at least %d characters", MinLength)
+	}
+	if length > MaxLength {
+		return fmt.Errorf("password must be at most %d characters", MaxLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+
+	lower := strings.ToLower(plain)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	if _, common := commonPasswords[lower]; common {
+		return errors.New("password is too common")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package password
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse 42")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ok, needsRehash, err := Verify("correct horse 42", hash)
+	if err != nil || !ok || needsRehash {
+		t.Errorf("Expected valid password without rehash, got ok=%v rehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	ok, _, err = Verify("wrong horse 42", hash)
+	if err != nil || ok {
+		t.Errorf("Expected mismatch, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestVerifyRequestsRehash(t *testing.T) {
+	original := DefaultParams
+	defer func() { DefaultParams = original }()
+
+	DefaultParams.Iterations = 1
+	hash, err := Hash("correct horse 42")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	DefaultParams = original
+
+	if ok, needsRehash, _ := Verify("correct horse 42", hash); !ok || !needsRehash {
+		t.Errorf("Expected rehash for outdated params, got ok=%v rehash=%v", ok, needsRehash)
+	}
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("correct horse 42"), bcrypt.MinCost)
+	if ok, needsRehash, _ := Verify("correct horse 42", string(bcryptHash)); !ok || !needsRehash {
+		t.Errorf("Expected rehash for bcrypt hash, got ok=%v rehash=%v", ok, needsRehash)
+	}
+
+	if ok, needsRehash, _ := Verify("legacy pass 1", "legacy pass 1"); !ok || !needsRehash {
+		t.Errorf("Expected rehash for plaintext password, got ok=%v rehash=%v", ok, needsRehash)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]bool{
+		"short1":             false,
+		"onlyletterslong":    false,
+		"12345678901":        false,
+		"password123":        false,
+		"johnsmith2024":      false,
+		"library card 2024!": true,
+	}
+	for plain, valid := range cases {
+		err := Validate(plain, "johnsmith")
+		if valid && err != nil {
+			t.Errorf("Expected %q to be valid, got %v", plain, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected %q to be rejected", plain)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/password"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/mail"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+// validateRegistration проверяет поля регистрации по тегам и надежность пароля и сообщает обо всех ошибках сразу
+func validateRegistration(request RegisterRequest) error {
+	fields := validate.Fields(request)
+	if request.Password != "" {
+		if err := password.Validate(request.Password, request.Username); err != nil {
+			fields = append(fields, problem.Field("password", "weak", err.Error()))
+		}
+	}
+	if len(fields) > 0 {
+		return problem.Validation(fields...)
+	}
+	return nil
+}
+
+// AccountFlows отправляет письма подтверждения адреса и сброса пароля и обрабатывает токены из них
+type AccountFlows struct {
+	Users    postgres.UserRepository
+	Tokens   postgres.UserTokenRepository
+	Mail     mail.Sender
+	Sessions *SessionManager
+	Config   config.MailConfig
+}
+
+func NewAccountFlows(users postgres.UserRepository, tokens postgres.UserTokenRepository, sender mail.Sender,
+	sessions *SessionManager, cfg config.MailConfig) *AccountFlows {
+	return &AccountFlows{Users: users, Tokens: tokens, Mail: sender, Sessions: sessions, Config: cfg}
+}
+
+// issue гасит прежние токены пользователя с тем же назначением и выдает новый
+func (a *AccountFlows) issue(ctx context.Context, user models.User, purpose string, ttl time.Duration) (string, error) {
+	if err := a.Tokens.InvalidateForUser(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = a.Tokens.Create(ctx, models.UserToken{
+		Hash:      hashToken(token),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	return token, err
+}
+
+// SendVerification отправляет пользователю ссылку для подтверждения адреса
+func (a *AccountFlows) SendVerification(ctx context.Context, user models.User) error {
+	token, err := a.issue(ctx, user, models.TokenVerifyEmail, a.Config.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	return a.Mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello, %s!\n\nConfirm your email address by opening the link below:\n%s/verify-email?token=%s\n\n"+
+			"The link is valid for %s. If you did not register, ignore this message.\n",
+			user.Username, strings.TrimRight(a.Config.BaseURL, "/"), token, a.Config.VerifyTTL),
+	})
+}
+
+// SendPasswordReset отправляет пользователю ссылку для сброса пароля
+func (a *AccountFlows) SendPasswordReset(ctx context.Context, user models.User) error {
+	token, err := a.issue(ctx, user, models.TokenResetPassword, a.Config.ResetTTL)
+	if err != nil {
+		return err
+	}
+	return a.Mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password open the link below:\n%s/reset-password?token=%s\n\n"+
+			"The link is valid for %s and can be used once. If you did not request a reset, ignore this message.\n",
+			user.Username, strings.TrimRight(a.Config.BaseURL, "/"), token, a.Config.ResetTTL),
+	})
+}
+
+// VerifyEmail подтверждает адрес по токену из письма после регистрации
+func VerifyEmail(accounts *AccountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+
+		token, err := accounts.Tokens.Consume(r.Context(), hashToken(request.Token), models.TokenVerifyEmail)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Адрес мог измениться после отправки письма — тогда подтверждать нечего
+		err = accounts.Users.MarkEmailVerified(r.Context(), token.UserID, token.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ResendVerification отправляет новую ссылку подтверждения на адрес пользователя; прежние ссылки перестают работать
+func ResendVerification(accounts *AccountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromContext(r.Context())
+		if !ok {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		user, err := accounts.Users.GetByID(r.Context(), identity.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if user.EmailVerified {
+			problem.Error(w, r, http.StatusConflict, problem.CodeEmailAlreadyVerified, "Email already verified")
+			return
+		}
+
+		if err := accounts.SendVerification(r.Context(), user); err != nil {
+			problem.Internal(w, r, fmt.Errorf("sending verification to user %d: %w", user.ID, err))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ForgotPassword отправляет одноразовую ссылку сброса пароля всем учетным записям с этим адресом.
+// Ответ не выдает, есть ли такие учетные записи.
+func ForgotPassword(accounts *AccountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Email) == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+
+		// Письма отправляются в фоне, чтобы время ответа не выдавало наличие учетной записи
+		go func(email string) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			users, err := accounts.Users.ListByEmail(ctx, email)
+			if err != nil {
+				log.Printf("Error looking up users for password reset: %v", err)
+				return
+			}
+			for _, user := range users {
+				if err := accounts.SendPasswordReset(ctx, user); err != nil {
+					log.Printf("Error sending password reset to user %d: %v", user.ID, err)
+				}
+			}
+		}(strings.TrimSpace(request.Email))
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ResetPassword задает новый пароль по одноразовому токену из письма и завершает все сессии пользователя
+func ResetPassword(accounts *AccountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+		tokenHash := hashToken(request.Token)
+
+		// Пароль проверяется до погашения токена, чтобы слабый пароль не сжигал ссылку
+		token, err := accounts.Tokens.Find(r.Context(), tokenHash, models.TokenResetPassword)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		user, err := accounts.Users.GetByID(r.Context(), strconv.Itoa(token.UserID))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := password.Validate(request.Password, user.Username); err != nil {
+			problem.Write(w, r, problem.Validation(problem.Field("password", "weak", err.Error())))
+			return
+		}
+
+		if _, err := accounts.Tokens.Consume(r.Context(), tokenHash, models.TokenResetPassword); errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired token")
+			return
+		} else if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		hash, err := password.Hash(request.Password)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := accounts.Users.UpdatePasswordHash(r.Context(), user.ID, hash); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		// Старые сессии могли принадлежать тому, из-за кого пароль сбрасывают
+		if err := accounts.Sessions.RevokeAll(r.Context(), user.ID); err != nil {
+			log.Printf("Error revoking sessions of user %d after password reset: %v", user.ID, err)
+		}
+		// Переход по ссылке из письма доказывает владение адресом
+		if err := accounts.Users.MarkEmailVerified(r.Context(), user.ID, token.Email); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error marking email of user %d verified: %v", user.ID, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+func TestValidateRegistration(t *testing.T) {
+	cases := []struct {
+		username, email string
+		valid           bool
+	}{
+		{"reader", "reader@example.com", true},
+		{"re", "reader@example.com", false},
+		{"reader name", "reader@example.com", false},
+		{"reader", "", false},
+		{"reader", "not-an-email", false},
+		{"reader", "Reader <reader@example.com>", false},
+	}
+	for _, c := range cases {
+		err := validateRegistration(RegisterRequest{Username: c.username, Email: c.email, Password: "shelf2024books"})
+		if c.valid && err != nil {
+			t.Errorf("%q/%q: expected valid, got %v", c.username, c.email, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%q/%q: expected error", c.username, c.email)
+		}
+	}
+}
+
+func TestValidateRegistrationListsEveryField(t *testing.T) {
+	err := validateRegistration(RegisterRequest{Username: "a b", Email: "nope", Password: "short"})
+	var p *problem.Problem
+	if !errors.As(err, &p) || p.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422 problem, got %v", err)
+	}
+	got := make(map[string]string)
+	for _, field := range p.Errors {
+		got[field.Field] = field.Code
+	}
+	want := map[string]string{"username": "invalid", "email": "invalid", "password": "weak"}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("Expected %s error for %s, got %v", code, field, p.Errors)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+// APIKeyPrefix отличает API ключи от JWT в заголовке Authorization
+const APIKeyPrefix = "glk_"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// IsAPIKey проверяет, похожа ли строка на API ключ
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// APIKeyManager выпускает API ключи и проверяет их при аутентификации
+type APIKeyManager struct {
+	Keys  postgres.APIKeyRepository
+	Users postgres.UserRepository
+
+	// Время последнего использования записывается не чаще раза в touchEvery
+	touchEvery  time.Duration
+	mu          sync.Mutex
+	lastTouched map[int]time.Time
+}
+
+func NewAPIKeyManager(keys postgres.APIKeyRepository, users postgres.UserRepository) *APIKeyManager {
+	return &APIKeyManager{Keys: keys, Users: users, touchEvery: time.Minute, lastTouched: make(map[int]time.Time)}
+}
+
+// Create выпускает ключ с областями из числа прав роли пользователя; mfa отмечает, что ключ выпущен
+// из сессии со вторым фактором. Открытый ключ возвращается только здесь.
+func (m *APIKeyManager) Create(ctx context.Context, user models.User, name string, scopes []Permission, expiresAt *time.Time, mfa bool) (models.APIKey, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	plain := APIKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    plain[:len(APIKeyPrefix)+8],
+		Scopes:    make([]string, 0, len(scopes)),
+		ExpiresAt: expiresAt,
+		MFA:       mfa,
+	}
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, string(scope))
+	}
+	key, err = m.Keys.Create(ctx, key, hashToken(plain))
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return key, plain, nil
+}
+
+// Authenticate находит ключ и его владельца. Роль берется из учетной записи,
+// поэтому понижение роли сразу сужает и права ключей. Второй фактор засчитывается,
+// только если ключ выпущен из сессии со вторым фактором.
+func (m *APIKeyManager) Authenticate(ctx context.Context, plain string) (Identity, error) {
+	key, err := m.Keys.GetActiveByHash(ctx, hashToken(plain))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+	user, err := m.Users.GetByID(ctx, strconv.Itoa(key.UserID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	m.touch(ctx, key.ID)
+
+	identity := Identity{
+		UserID:   strconv.Itoa(user.ID),
+		Username: user.Username,
+		Role:     user.Role,
+		APIKeyID: key.ID,
+		MFA:      key.MFA,
+		Scopes:   make([]Permission, 0, len(key.Scopes)),
+	}
+	for _, scope := range key.Scopes {
+		identity.Scopes = append(identity.Scopes, Permission(scope))
+	}
+	return identity, nil
+}
+
+func (m *APIKeyManager) touch(ctx context.Context, id int) {
+	now := time.Now()
+	m.mu.Lock()
+	if now.Sub(m.lastTouched[id]) < m.touchEvery {
+		m.mu.Unlock()
+		return
+	}
+	m.lastTouched[id] = now
+	m.mu.Unlock()
+
+	if err := m.Keys.TouchLastUsed(ctx, id, now); err != nil {
+		log.Printf("Error updating last use of API key %d: %v", id, err)
+	}
+}
+
+// CreateAPIKeyRequest описывает новый API ключ
+type CreateAPIKeyRequest struct {
+	Name      string       `json:"name"`
+	Scopes    []Permission `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse содержит открытый ключ, который больше нигде не показывается
+type CreateAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// ListAPIKeys возвращает действующие API ключи пользователя без секретной части
+func ListAPIKeys(apiKeys *APIKeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+		keys, err := apiKeys.Keys.ListForUser(r.Context(), userID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// CreateAPIKey выпускает API ключ с областями из прав роли пользователя. Ключ показывается один раз;
+// выпустить его можно только из сессии входа, а не по другому ключу. Ключ наследует от сессии отметку
+// о втором факторе, если выпускается для самого владельца сессии: без нее ключ не пройдет проверку MFA
+// для ролей, которым второй фактор обязателен.
+func CreateAPIKey(apiKeys *APIKeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Ключ не может выпускать другие ключи, иначе отзыв ключа ничего бы не гарантировал
+		identity, _ := FromContext(r.Context())
+		if identity.APIKeyID != 0 {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeAPIKeyNotAllowed, "API keys cannot be managed with an API key")
+			return
+		}
+
+		var request CreateAPIKeyRequest
+		if err := validate.Decode(w, r, &request); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		request.Name = strings.TrimSpace(request.Name)
+		if request.Name == "" || len(request.Name) > 100 {
+			problem.Write(w, r, problem.Validation(problem.Field("name", "invalid", "name is required and must be at most 100 characters")))
+			return
+		}
+		if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+			problem.Write(w, r, problem.Validation(problem.Field("expires_at", "invalid", "expires_at must be in the future")))
+			return
+		}
+
+		user, err := apiKeys.Users.GetByID(r.Context(), chi.URLParam(r, "id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if len(request.Scopes) == 0 {
+			problem.Write(w, r, problem.Validation(problem.Field("scopes", "required", "at least one scope is required")))
+			return
+		}
+		for _, scope := range request.Scopes {
+			if !HasPermission(user.Role, scope) {
+				problem.Write(w, r, problem.Validation(problem.Field("scopes", "invalid", "scope "+string(scope)+" is not available to the user's role")))
+				return
+			}
+		}
+
+		// Отметку второго фактора сессия передает только ключам своего пользователя: администратор,
+		// выпускающий ключ другому, не подтверждал второй фактор за него
+		mfa := identity.MFA && identity.UserID == strconv.Itoa(user.ID)
+		key, plain, err := apiKeys.Create(r.Context(), user, request.Name, request.Scopes, request.ExpiresAt, mfa)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: key, Key: plain})
+	}
+}
+
+// RevokeAPIKey отзывает API ключ; запросы с ним сразу отклоняются
+func RevokeAPIKey(apiKeys *APIKeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if identity, _ := FromContext(r.Context()); identity.APIKeyID != 0 {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeAPIKeyNotAllowed, "API keys cannot be managed with an API key")
+			return
+		}
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+		keyID, err := strconv.Atoi(chi.URLParam(r, "keyID"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid key ID")
+			return
+		}
+
+		err = apiKeys.Keys.Revoke(r.Context(), userID, keyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeAPIKeyNotFound, "Key not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
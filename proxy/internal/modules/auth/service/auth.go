@@ -1,128 +1,324 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
+	"sync"
 
 	"github.com/brianvoe/gofakeit"
-	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/password"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
 )
 
-// @Summary Register a new user
-// @Description This endpoint allows you to register a new user with a username and password.
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param user body User true "User registration details"
-// @Success 201 {object} TokenResponse "User registered successfully"
-// @Failure 400 {object} ErrorResponse "Invalid request"
-// @Failure 409 {object} ErrorResponse "User already exists"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/register [post]
-func Register(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
+// Register регистрирует пользователя по логину, паролю и адресу и отправляет ссылку подтверждения адреса
+func Register(userRepo postgres.UserRepository, accounts *AccountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RegisterRequest
+		if err := validate.Decode(w, r, &request); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		if err := validateRegistration(request); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
 
-	mu.Lock()
-	defer mu.Unlock()
+		_, err := userRepo.GetByUsername(r.Context(), request.Username)
+		if err == nil {
+			problem.Error(w, r, http.StatusConflict, problem.CodeAlreadyExists, "User already exists")
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			problem.Internal(w, r, err)
+			return
+		}
 
-	if _, exists := Users[user.Username]; exists {
-		http.Error(w, "User already exists", http.StatusConflict)
-		return
-	}
+		// Имя профиля по умолчанию совпадает с логином
+		name := request.Name
+		if name == "" {
+			name = request.Username
+		}
+		hash, err := password.Hash(request.Password)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		user := models.User{
+			Username:     request.Username,
+			PasswordHash: hash,
+			Name:         name,
+			Email:        request.Email,
+			Role:         models.DefaultRole,
+		}
+		id, err := userRepo.Create(r.Context(), user)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		user.ID = id
+
+		// Неотправленное письмо не отменяет регистрацию: его можно запросить повторно
+		if err := accounts.SendVerification(r.Context(), user); err != nil {
+			log.Printf("Error sending verification to user %d: %v", user.ID, err)
+		}
 
-	Users[user.Username] = User{
-		Username: user.Username,
-		Password: user.Password,
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(user)
 	}
+}
 
-	// Используем логин пользователя в качестве user_id
+// Login выдает токены по логину и паролю
+func Login(userRepo postgres.UserRepository, sessions *SessionManager, guard *LoginGuard, mfa *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
 
-}
+		ip := clientIP(r)
+		if !checkLoginAllowed(w, r, guard, user.Username, ip) {
+			return
+		}
+		invalidCredentials := func() {
+			if err := guard.Failure(r.Context(), user.Username, ip); err != nil {
+				log.Printf("Error recording failed login for %s: %v", user.Username, err)
+			}
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
+		}
 
-// @Summary Login a user
-// @Description This endpoint allows a user to log in with their username and password.
-// @Tags auth
-// @Produce json
-// @Param user body User true "User login details"
-// @Success 200 {object} LoginResponse "Login successful"
-// @Failure 400 {object} ErrorResponse "Invalid request"
-// @Failure 401 {object} ErrorResponse "Invalid credentials"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/login [post]
-func Login(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
+		// Получаем данные пользователя из базы данных
+		storedUser, err := userRepo.GetByUsername(r.Context(), user.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Проверяем пароль против фиктивного хеша, чтобы время ответа не выдавало существование логина
+			password.Verify(user.Password, dummyHash())
+			invalidCredentials()
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
 
-	// Получаем данные пользователя из мапы Users
-	storedUser, exists := Users[user.Username]
-	if !exists {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
+		// Проверяем совпадение пароля
+		ok, needsRehash, err := password.Verify(user.Password, storedUser.PasswordHash)
+		if err != nil || !ok {
+			invalidCredentials()
+			return
+		}
 
-	// Проверяем совпадение пароля
-	if storedUser.Password != user.Password {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
+		// Пароль, заданный при развертывании, заменяется при первом входе: без new_password токены не выдаются
+		if storedUser.MustChangePassword {
+			if !changeInitialPassword(w, r, userRepo, storedUser, user) {
+				return
+			}
+			needsRehash = false
+		}
+
+		// Пересчитываем устаревший хеш, пока известен открытый пароль
+		if needsRehash {
+			if hash, err := password.Hash(user.Password); err == nil {
+				if err := userRepo.UpdatePasswordHash(r.Context(), storedUser.ID, hash); err != nil {
+					log.Printf("Error rehashing password for user %d: %v", storedUser.ID, err)
+				}
+			}
+		}
+
+		// При подключенном втором факторе вход завершается в /api/login/mfa.
+		// Счетчик неудач не сбрасывается до проверки кода, иначе верный пароль позволял бы перебирать коды.
+		enabled, err := mfa.Enabled(r.Context(), storedUser.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if enabled {
+			challenge, err := mfa.Challenge(storedUser)
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Content-Type", "application/json;charset=utf-8")
+			json.NewEncoder(w).Encode(MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challenge,
+				ExpiresIn:   int(mfaChallengeTTL.Seconds()),
+			})
+			return
+		}
+		if err := guard.Success(r.Context(), user.Username); err != nil {
+			log.Printf("Error resetting failed logins for %s: %v", user.Username, err)
+		}
+
+		// Если авторизация успешна, открываем сессию и выдаем токены
+		tokens, err := sessions.Start(r.Context(), storedUser, r, false)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		writeTokens(w, tokens)
 	}
+}
 
-	// Если авторизация успешна, создаем токен
-	claims := map[string]interface{}{
-		"user_id": user.Username, // Используем username как user_id
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+// changeInitialPassword сохраняет new_password из запроса входа. Без нового пароля отвечает 403 must_change_password,
+// со слабым или прежним паролем — 422; в этих случаях возвращает false.
+func changeInitialPassword(w http.ResponseWriter, r *http.Request, userRepo postgres.UserRepository, storedUser models.User, request User) bool {
+	if request.NewPassword == "" {
+		problem.Write(w, r, problem.Forbidden(problem.CodeMustChangePassword,
+			"password must be changed: repeat login with new_password"))
+		return false
+	}
+	if request.NewPassword == request.Password {
+		problem.Write(w, r, problem.Validation(problem.Field("new_password", "weak", "new_password must differ from the current password")))
+		return false
+	}
+	if err := password.Validate(request.NewPassword, storedUser.Username); err != nil {
+		problem.Write(w, r, problem.Validation(problem.Field("new_password", "weak", err.Error())))
+		return false
 	}
-	_, tokenString, err := TokenAuth.Encode(claims)
+	hash, err := password.Hash(request.NewPassword)
 	if err != nil {
-		http.Error(w, "Could not create token", http.StatusInternalServerError)
-		return
+		problem.Internal(w, r, err)
+		return false
+	}
+	if err := userRepo.UpdatePasswordHash(r.Context(), storedUser.ID, hash); err != nil {
+		problem.Internal(w, r, err)
+		return false
 	}
+	return true
+}
 
-	w.Header().Set("Authorization", "Bearer "+tokenString)
+// checkLoginAllowed отвечает 429 с Retry-After, если вход для учетной записи или IP заблокирован
+func checkLoginAllowed(w http.ResponseWriter, r *http.Request, guard *LoginGuard, username, ip string) bool {
+	wait, err := guard.Check(r.Context(), username, ip)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		problem.Error(w, r, http.StatusTooManyRequests, problem.CodeTooManyRequests, "Too many failed login attempts, try again later")
+		return false
+	}
+	return true
+}
+
+func writeTokens(w http.ResponseWriter, tokens TokenResponse) {
+	w.Header().Set("Authorization", "Bearer "+tokens.Token)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(TokenResponse{Token: tokenString})
-	fmt.Println(tokenString)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue string
+)
+
+func dummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = password.Hash("dummy password 0")
+	})
+	return dummyHashValue
 }
 
-func GenerateUsers(count int) {
+// GenerateUsers создает демонстрационных пользователей со случайными паролями, которые нигде не сохраняются.
+// Только для разработки: пользователи создаются, если count > 0 и в базе еще нет ни одного пользователя.
+func GenerateUsers(userRepo postgres.UserRepository, count int) {
+	if count == 0 {
+		return
+	}
+	existing, err := userRepo.List(context.Background(), 1, 0)
+	if err != nil {
+		log.Printf("Error checking users before seeding: %v", err)
+		return
+	}
+	if len(existing) > 0 {
+		return
+	}
 	for i := 0; i < count; i++ {
-		username := gofakeit.Username()                                   // Генерация случайного имени пользователя
-		password := gofakeit.Password(true, true, true, false, false, 10) // Генерация случайного пароля
+		username := gofakeit.Username() // Генерация случайного имени пользователя
+		hash, err := password.Hash(gofakeit.Password(true, true, true, false, false, 16))
+		if err != nil {
+			log.Printf("Error hashing password for user %s: %v", username, err)
+			continue
+		}
 
-		Users[username] = User{
-			Username: username,
-			Password: password,
+		_, err = userRepo.Create(context.Background(), models.User{
+			Username:     username,
+			PasswordHash: hash,
+			Name:         gofakeit.Name(),
+			Email:        gofakeit.Email(),
+			Role:         models.DefaultRole,
+		})
+		if err != nil {
+			log.Printf("Error creating user %s: %v", username, err)
+			continue
 		}
-		fmt.Printf("Created user: %s with password: %s\n", username, password)
+		log.Printf("Created user: %s", username)
 	}
 }
 
-// @Summary Get List of Registered Users
-// @Description This endpoint returns a list of all registered users.
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Success 200 {array} User "List of registered users"
-// @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /api/users [get]
-func ListUsersHandler(resp controller.Responder) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		mu.Lock()
-		defer mu.Unlock()
-		// Здесь предполагается, что Users - это глобальная переменная, содержащая всех пользователей
-		var users []User
-		for _, user := range Users {
-			users = append(users, user)
-		}
+// EnsureAdmin создает первого администратора, если его учетной записи еще нет. Пароль приходит из секрета
+// развертывания и должен быть сменен при первом входе. Без логина ничего не делает; ошибка, если
+// администратора нужно создать, а пароля нет или он слабый.
+func EnsureAdmin(userRepo postgres.UserRepository, username, plain string) error {
+	if username == "" {
+		return nil
+	}
+	_, err := userRepo.GetByUsername(context.Background(), username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("looking up admin %s: %w", username, err)
+	}
+	if plain == "" {
+		return fmt.Errorf("admin %s does not exist and ADMIN_PASSWORD or ADMIN_PASSWORD_FILE is not set", username)
+	}
+	if err := password.Validate(plain, username); err != nil {
+		return fmt.Errorf("admin %s not created: %w", username, err)
+	}
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return fmt.Errorf("hashing password for admin %s: %w", username, err)
+	}
 
-		resp.OutputJSON(w, users) // Возвращаем список пользователей
+	_, err = userRepo.Create(context.Background(), models.User{
+		Username:           username,
+		PasswordHash:       hash,
+		Name:               username,
+		Email:              "",
+		Role:               models.RoleAdmin,
+		MustChangePassword: true,
+	})
+	if err != nil {
+		return fmt.Errorf("creating admin %s: %w", username, err)
+	}
+	log.Printf("Created admin: %s", username)
+	return nil
+}
+
+// JWKSHandler отдает публичные ключи для проверки подписи токенов доступа
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	set, err := TokenAuth.JWKS()
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
 }
@@ -1,32 +1,87 @@
 package service
 
-import (
-	"sync"
-
-	"github.com/go-chi/jwtauth"
-)
+import "studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
 
 type LoginResponse struct {
 	Message string `json:"message"`
 }
 
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"` // Токен доступа
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Срок действия токена доступа в секундах
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshRequest представляет запрос на обновление токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
-type ErrorResponse struct {
-	BadRequest      string `json:"400"`
-	DadataBad       string `json:"500"`
-	SuccefulRequest string `json:"200"`
+// SessionResponse описывает активную сессию пользователя
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"` // Сессия, в которой выполнен запрос
 }
 
-var (
-	TokenAuth = jwtauth.New("HS256", []byte("your_secret_key"), nil)
-	Users     = make(map[string]User) // Хранение пользователей
-	mu        sync.Mutex
-)
+// TokenAuth подписывает и проверяет токены доступа; настраивается через InitTokenAuth
+var TokenAuth = NewEphemeralKeyRing()
 
 type User struct {
-	Username string `json:"username"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password,omitempty"` // Обязателен, если пароль нужно сменить при первом входе
+}
+
+// RegisterRequest представляет данные для регистрации пользователя
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,username"`
+	Password string `json:"password" validate:"required"`
+	Name     string `json:"name" validate:"max=50"` // По умолчанию совпадает с логином
+	Email    string `json:"email" validate:"required,max=255,email"`
+}
+
+// VerifyEmailRequest содержит токен из письма подтверждения адреса
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest запрашивает письмо для сброса пароля
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest задает новый пароль по токену из письма
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
+
+// MFAChallengeResponse возвращается на первом шаге входа, если у пользователя подключен второй фактор
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`  // Передается в /api/login/mfa вместе с кодом
+	ExpiresIn   int    `json:"expires_in"` // Срок действия mfa_token в секундах
+}
+
+// MFALoginRequest завершает вход вторым фактором
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP код или код восстановления
+}
+
+// MFACodeRequest содержит код из приложения-аутентификатора или код восстановления
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAEnrollResponse содержит секрет для подключения приложения-аутентификатора
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// ссылка для QR-кода
+}
+
+// RecoveryCodesResponse содержит коды восстановления; они показываются один раз
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,27 @@
+package service
+
+import "context"
+
+type identityCtxKey struct{}
+
+// Identity описывает пользователя, от имени которого выполняется запрос
+type Identity struct {
+	UserID    string
+	Username  string
+	Role      string
+	SessionID string
+	MFA       bool         // Вход подтвержден вторым фактором
+	APIKeyID  int          // Не ноль, если запрос выполнен по API ключу
+	Scopes    []Permission // Области API ключа
+}
+
+// NewContext сохраняет пользователя из токена в контексте запроса
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityCtxKey{}, identity)
+}
+
+// FromContext возвращает пользователя, прошедшего аутентификацию
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityCtxKey{}).(Identity)
+	return identity, ok
+}
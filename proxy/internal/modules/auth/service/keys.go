@@ -0,0 +1,264 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+)
+
+// Допустимое расхождение часов между сервисами при проверке exp/nbf/iat
+const clockSkew = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// SigningKey — ключ подписи токенов, идентифицируемый по kid
+type SigningKey struct {
+	ID        string
+	Algorithm jwa.SignatureAlgorithm
+	signKey   interface{} // nil для ключей, оставленных только для проверки
+	verifyKey interface{}
+}
+
+// KeyRing подписывает токены активным ключом и проверяет токены любым из известных ключей,
+// что позволяет менять ключи без выхода всех пользователей из системы
+type KeyRing struct {
+	active   *SigningKey
+	keys     map[string]*SigningKey
+	issuer   string
+	audience string
+}
+
+// NewKeyRing собирает набор ключей из настроек. Формат JWT_KEYS:
+// "kid:alg:path[,kid:alg:path...]", где path — PEM-файл с ключом RSA/Ed25519
+// (публичный ключ оставляет kid только для проверки) или файл с секретом для HS*.
+func NewKeyRing(cfg config.JWTConfig) (*KeyRing, error) {
+	ring := &KeyRing{
+		keys:     make(map[string]*SigningKey),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+
+	for _, spec := range strings.Split(cfg.Keys, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid key spec %q, expected kid:alg:path", spec)
+		}
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("reading key %s: %w", parts[0], err)
+		}
+		key, err := parseSigningKey(parts[0], jwa.SignatureAlgorithm(parts[1]), data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key %s: %w", parts[0], err)
+		}
+		ring.keys[key.ID] = key
+	}
+
+	// Одиночный общий секрет из JWT_SECRET для простых установок
+	if len(ring.keys) == 0 && cfg.Secret != "" {
+		key, err := parseSigningKey("default", jwa.HS256, []byte(cfg.Secret))
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SECRET: %w", err)
+		}
+		ring.keys[key.ID] = key
+		if cfg.ActiveKeyID == "" {
+			cfg.ActiveKeyID = "default"
+		}
+	}
+	if len(ring.keys) == 0 {
+		return nil, errors.New("no JWT signing keys configured")
+	}
+
+	ring.active = ring.keys[cfg.ActiveKeyID]
+	if ring.active == nil || ring.active.signKey == nil {
+		return nil, fmt.Errorf("active key %q not found or has no private part", cfg.ActiveKeyID)
+	}
+	return ring, nil
+}
+
+// NewEphemeralKeyRing создает набор из одного случайного HS256 ключа для тестов; токены теряют силу после перезапуска
+func NewEphemeralKeyRing() *KeyRing {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	key := &SigningKey{ID: "ephemeral", Algorithm: jwa.HS256, signKey: secret, verifyKey: secret}
+	return &KeyRing{active: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+// InitTokenAuth настраивает TokenAuth из переменных окружения. Без ключей или с неверным ключом
+// возвращается ошибка: со случайным ключом токены теряли бы силу при каждом перезапуске.
+func InitTokenAuth() error {
+	cfg, err := config.JWTSettings()
+	if err != nil {
+		return err
+	}
+	ring, err := NewKeyRing(cfg)
+	if err != nil {
+		return err
+	}
+	TokenAuth = ring
+	return nil
+}
+
+func parseSigningKey(id string, alg jwa.SignatureAlgorithm, data []byte) (*SigningKey, error) {
+	key := &SigningKey{ID: id, Algorithm: alg}
+
+	switch alg {
+	case jwa.HS256, jwa.HS384, jwa.HS512:
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < 32 {
+			return nil, errors.New("HMAC secret must be at least 32 bytes")
+		}
+		key.signKey, key.verifyKey = secret, secret
+		return key, nil
+	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512, jwa.EdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.signKey, key.verifyKey = k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.verifyKey = k
+	case ed25519.PrivateKey:
+		key.signKey, key.verifyKey = k, k.Public()
+	case ed25519.PublicKey:
+		key.verifyKey = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	_, isRSA := key.verifyKey.(*rsa.PublicKey)
+	if isRSA == (alg == jwa.EdDSA) {
+		return nil, fmt.Errorf("key type does not match algorithm %s", alg)
+	}
+	return key, nil
+}
+
+// Encode подписывает claims активным ключом, добавляя iss, aud, iat и nbf
+func (k *KeyRing) Encode(claims map[string]interface{}) (jwt.Token, string, error) {
+	now := time.Now()
+	t := jwt.New()
+	for name, value := range claims {
+		if err := t.Set(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+	t.Set(jwt.IssuedAtKey, now.Unix())
+	t.Set(jwt.NotBeforeKey, now.Unix())
+	if k.issuer != "" {
+		t.Set(jwt.IssuerKey, k.issuer)
+	}
+	if k.audience != "" {
+		t.Set(jwt.AudienceKey, k.audience)
+	}
+
+	headers := jws.NewHeaders()
+	headers.Set(jws.KeyIDKey, k.active.ID)
+	signed, err := jwt.Sign(t, k.active.Algorithm, k.active.signKey, jwt.WithHeaders(headers))
+	if err != nil {
+		return nil, "", err
+	}
+	return t, string(signed), nil
+}
+
+// Verify проверяет подпись ключом из kid, а также exp, nbf, iat, iss и aud
+func (k *KeyRing) Verify(tokenString string) (jwt.Token, error) {
+	msg, err := jws.ParseString(tokenString)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return nil, ErrInvalidToken
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+
+	key, ok := k.keys[headers.KeyID()]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	// Алгоритм берется из настроек ключа, а не из заголовка токена
+	if headers.Algorithm() != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := jwt.ParseString(tokenString, jwt.WithVerify(key.Algorithm, key.verifyKey))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if token.Expiration().IsZero() {
+		return nil, errors.New("token has no expiration")
+	}
+	options := []jwt.ValidateOption{jwt.WithAcceptableSkew(clockSkew)}
+	if k.issuer != "" {
+		if token.Issuer() != k.issuer {
+			return nil, errors.New("iss not satisfied")
+		}
+		options = append(options, jwt.WithIssuer(k.issuer))
+	}
+	if k.audience != "" {
+		options = append(options, jwt.WithAudience(k.audience))
+	}
+	if err := jwt.Validate(token, options...); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// JWKS возвращает публичные ключи для проверки токенов внешними сервисами.
+// Симметричные ключи не публикуются.
+func (k *KeyRing) JWKS() (jwk.Set, error) {
+	set := jwk.NewSet()
+	for _, key := range k.keys {
+		if _, symmetric := key.verifyKey.([]byte); symmetric {
+			continue
+		}
+		public, err := jwk.New(key.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		public.Set(jwk.KeyIDKey, key.ID)
+		public.Set(jwk.AlgorithmKey, key.Algorithm.String())
+		public.Set(jwk.KeyUsageKey, "sig")
+		set.Add(public)
+	}
+	return set, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaPublicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	oldPrivate := writePEM(t, dir, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	oldPublic := writePEM(t, dir, "old.pub", "PUBLIC KEY", rsaPublicDER)
+	newPrivate := writePEM(t, dir, "new.pem", "PRIVATE KEY", edDER)
+
+	oldRing, err := NewKeyRing(config.JWTConfig{Keys: "k1:RS256:" + oldPrivate, ActiveKeyID: "k1", Issuer: "lib", Audience: "api"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_, oldToken, err := oldRing.Encode(map[string]interface{}{"user_id": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// После ротации старый ключ остается только для проверки
+	newRing, err := NewKeyRing(config.JWTConfig{Keys: "k1:RS256:" + oldPublic + ",k2:EdDSA:" + newPrivate, ActiveKeyID: "k2", Issuer: "lib", Audience: "api"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := newRing.Verify(oldToken); err != nil {
+		t.Errorf("Expected token signed by retired key to verify, got %v", err)
+	}
+	_, newToken, err := newRing.Encode(map[string]interface{}{"user_id": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := newRing.Verify(newToken); err != nil {
+		t.Errorf("Expected new token to verify, got %v", err)
+	}
+	if _, err := oldRing.Verify(newToken); err == nil {
+		t.Error("Expected token with unknown kid to be rejected")
+	}
+
+	set, err := newRing.JWKS()
+	if err != nil || set.Len() != 2 {
+		t.Errorf("Expected 2 public keys in JWKS, got %v (err %v)", set, err)
+	}
+
+	if _, err := NewKeyRing(config.JWTConfig{Keys: "k1:RS256:" + oldPublic, ActiveKeyID: "k1"}); err == nil {
+		t.Error("Expected error for active key without private part")
+	}
+}
+
+func TestKeyRingValidatesClaims(t *testing.T) {
+	ring, err := NewKeyRing(config.JWTConfig{Secret: "0123456789abcdef0123456789abcdef", Issuer: "lib", Audience: "api"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	other, _ := NewKeyRing(config.JWTConfig{Secret: "0123456789abcdef0123456789abcdef", Issuer: "other", Audience: "api"})
+
+	_, foreign, _ := other.Encode(map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := ring.Verify(foreign); err == nil {
+		t.Error("Expected token from another issuer to be rejected")
+	}
+
+	_, noExp, _ := ring.Encode(map[string]interface{}{"user_id": "1"})
+	if _, err := ring.Verify(noExp); err == nil {
+		t.Error("Expected token without exp to be rejected")
+	}
+}
+
+func TestKeyRingRejectsMissingOrWeakSecret(t *testing.T) {
+	for _, cfg := range []config.JWTConfig{{}, {Secret: "dev-secret"}} {
+		if _, err := NewKeyRing(cfg); err == nil {
+			t.Errorf("Expected error for secret %q", cfg.Secret)
+		}
+	}
+}
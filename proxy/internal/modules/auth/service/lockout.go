@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+// LoginGuard ограничивает перебор паролей: считает неудачные входы по учетной записи и по IP
+// и блокирует вход с экспоненциально растущей длительностью
+type LoginGuard struct {
+	Attempts postgres.LoginAttemptRepository
+	Audit    postgres.AuditRepository
+	Config   config.LoginThrottleConfig
+}
+
+func NewLoginGuard(attempts postgres.LoginAttemptRepository, audit postgres.AuditRepository, cfg config.LoginThrottleConfig) *LoginGuard {
+	return &LoginGuard{Attempts: attempts, Audit: audit, Config: cfg}
+}
+
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check возвращает, сколько еще действует блокировка учетной записи или IP; ноль — вход разрешен
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{accountKey(username), ipKey(ip)} {
+		until, err := g.Attempts.LockedUntil(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if left := time.Until(until); left > wait {
+			wait = left
+		}
+	}
+	return wait, nil
+}
+
+// Failure учитывает неудачный вход и при превышении порога блокирует учетную запись или IP
+func (g *LoginGuard) Failure(ctx context.Context, username, ip string) error {
+	limits := []struct {
+		key       string
+		threshold int
+		event     string
+	}{
+		{accountKey(username), g.Config.AccountMaxFailures, models.AuditAccountLocked},
+		{ipKey(ip), g.Config.IPMaxFailures, models.AuditIPLocked},
+	}
+	for _, limit := range limits {
+		failures, err := g.Attempts.RecordFailure(ctx, limit.key, g.Config.FailureWindow)
+		if err != nil {
+			return err
+		}
+		if failures < limit.threshold {
+			continue
+		}
+
+		duration := lockoutDuration(failures-limit.threshold, g.Config.BaseLockout, g.Config.MaxLockout)
+		if err := g.Attempts.Lock(ctx, limit.key, time.Now().Add(duration)); err != nil {
+			return err
+		}
+		err = g.Audit.Record(ctx, models.AuditEntry{
+			Event:    limit.event,
+			Username: username,
+			IP:       ip,
+			Details:  fmt.Sprintf("%d failed attempts, locked for %s", failures, duration),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Success сбрасывает счетчик учетной записи. Счетчик IP не сбрасывается,
+// чтобы вход в свою учетную запись не позволял продолжать перебор чужих.
+func (g *LoginGuard) Success(ctx context.Context, username string) error {
+	return g.Attempts.Reset(ctx, accountKey(username))
+}
+
+// Unlock снимает блокировку учетной записи по решению администратора
+func (g *LoginGuard) Unlock(ctx context.Context, actor Identity, username, ip string) error {
+	if err := g.Attempts.Reset(ctx, accountKey(username)); err != nil {
+		return err
+	}
+	entry := models.AuditEntry{Event: models.AuditAccountUnlocked, Username: username, IP: ip}
+	if actorID, err := strconv.Atoi(actor.UserID); err == nil {
+		entry.ActorID = &actorID
+	}
+	return g.Audit.Record(ctx, entry)
+}
+
+// lockoutDuration удваивает блокировку за каждую неудачу сверх порога, не превышая max
+func lockoutDuration(excess int, base, max time.Duration) time.Duration {
+	duration := base
+	for i := 0; i < excess && duration < max; i++ {
+		duration *= 2
+	}
+	if duration > max {
+		return max
+	}
+	return duration
+}
+
+// UnlockUser сбрасывает неудачные попытки входа и снимает блокировку; действие пишется в журнал аудита
+func UnlockUser(userRepo postgres.UserRepository, guard *LoginGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userRepo.GetByIDWithDeleted(r.Context(), chi.URLParam(r, "id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeUserNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		actor, _ := FromContext(r.Context())
+		if err := guard.Unlock(r.Context(), actor, user.Username, clientIP(r)); err != nil {
+			problem.Internal(w, r, fmt.Errorf("unlocking user %d: %w", user.ID, err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+)
+
+type memoryAttempts struct {
+	failures map[string]int
+	locked   map[string]time.Time
+}
+
+func (m *memoryAttempts) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	m.failures[key]++
+	return m.failures[key], nil
+}
+
+func (m *memoryAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	m.locked[key] = until
+	return nil
+}
+
+func (m *memoryAttempts) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	return m.locked[key], nil
+}
+
+func (m *memoryAttempts) Reset(ctx context.Context, key string) error {
+	delete(m.failures, key)
+	delete(m.locked, key)
+	return nil
+}
+
+type memoryAudit []models.AuditEntry
+
+func (m *memoryAudit) Record(ctx context.Context, entry models.AuditEntry) error {
+	*m = append(*m, entry)
+	return nil
+}
+
+func TestLockoutDuration(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  time.Minute,
+		1:  2 * time.Minute,
+		3:  8 * time.Minute,
+		10: time.Hour,
+	}
+	for excess, expected := range cases {
+		if got := lockoutDuration(excess, time.Minute, time.Hour); got != expected {
+			t.Errorf("excess %d: expected %s, got %s", excess, expected, got)
+		}
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	ctx := context.Background()
+	attempts := &memoryAttempts{failures: map[string]int{}, locked: map[string]time.Time{}}
+	audit := &memoryAudit{}
+	guard := NewLoginGuard(attempts, audit, config.LoginThrottleConfig{
+		AccountMaxFailures: 3,
+		IPMaxFailures:      10,
+		BaseLockout:        time.Minute,
+		MaxLockout:         time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		guard.Failure(ctx, "Reader", "10.0.0.1")
+	}
+	if wait, _ := guard.Check(ctx, "reader", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected no lockout below threshold, got %s", wait)
+	}
+
+	guard.Failure(ctx, "reader", "10.0.0.1")
+	if wait, _ := guard.Check(ctx, "READER", "10.0.0.2"); wait <= 0 {
+		t.Fatal("Expected account to be locked after reaching the threshold")
+	}
+	if len(*audit) != 1 || (*audit)[0].Event != models.AuditAccountLocked {
+		t.Errorf("Expected one account_locked audit entry, got %+v", *audit)
+	}
+
+	guard.Unlock(ctx, Identity{UserID: "1"}, "reader", "10.0.0.9")
+	if wait, _ := guard.Check(ctx, "reader", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected account to be unlocked, got %s", wait)
+	}
+	if last := (*audit)[len(*audit)-1]; last.Event != models.AuditAccountUnlocked || last.ActorID == nil || *last.ActorID != 1 {
+		t.Errorf("Expected account_unlocked entry with actor, got %+v", last)
+	}
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/totp"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var errInvalidChallenge = errors.New("invalid or expired MFA token")
+
+// MFAPolicy определяет роли, которым нельзя работать без второго фактора
+type MFAPolicy struct {
+	RequiredRoles map[string]bool
+}
+
+func NewMFAPolicy(roles []string) MFAPolicy {
+	policy := MFAPolicy{RequiredRoles: make(map[string]bool)}
+	for _, role := range roles {
+		policy.RequiredRoles[role] = true
+	}
+	return policy
+}
+
+// Satisfied сообщает, может ли пользователь работать: роль не требует MFA или вход выполнен со вторым
+// фактором. Для API ключа это значит, что ключ выпущен из сессии со вторым фактором.
+func (p MFAPolicy) Satisfied(identity Identity) bool {
+	return !p.RequiredRoles[identity.Role] || identity.MFA
+}
+
+// MFAManager подключает TOTP и проверяет второй фактор при входе
+type MFAManager struct {
+	Repo     postgres.MFARepository
+	Users    postgres.UserRepository
+	Sessions *SessionManager
+	APIKeys  postgres.APIKeyRepository
+	Guard    *LoginGuard
+	Config   config.MFAConfig
+}
+
+func NewMFAManager(repo postgres.MFARepository, users postgres.UserRepository, sessions *SessionManager,
+	apiKeys postgres.APIKeyRepository, guard *LoginGuard, cfg config.MFAConfig) *MFAManager {
+	return &MFAManager{Repo: repo, Users: users, Sessions: sessions, APIKeys: apiKeys, Guard: guard, Config: cfg}
+}
+
+// dropElevation завершает сессии пользователя и снимает отметку второго фактора с его API ключей,
+// чтобы после отключения второго фактора не осталось входов, которые считаются подтвержденными им
+func (m *MFAManager) dropElevation(ctx context.Context, userID int) error {
+	if err := m.Sessions.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	return m.APIKeys.ClearMFA(ctx, userID)
+}
+
+// Enabled сообщает, подключен ли у пользователя второй фактор
+func (m *MFAManager) Enabled(ctx context.Context, userID int) (bool, error) {
+	mfa, err := m.Repo.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mfa.Enabled(), nil
+}
+
+// Challenge выдает короткоживущий токен первого шага входа. У него нет user_id и sid,
+// поэтому как токен доступа он не принимается.
+func (m *MFAManager) Challenge(user models.User) (string, error) {
+	_, token, err := TokenAuth.Encode(map[string]interface{}{
+		"mfa_uid": strconv.Itoa(user.ID),
+		"purpose": "mfa",
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+	return token, err
+}
+
+func (m *MFAManager) parseChallenge(token string) (string, error) {
+	parsed, err := TokenAuth.Verify(token)
+	if err != nil {
+		return "", errInvalidChallenge
+	}
+	purpose, _ := parsed.Get("purpose")
+	userID, _ := parsed.Get("mfa_uid")
+	id, _ := userID.(string)
+	if purpose != "mfa" || id == "" {
+		return "", errInvalidChallenge
+	}
+	return id, nil
+}
+
+// verifyCode принимает текущий TOTP код или неиспользованный код восстановления
+func (m *MFAManager) verifyCode(ctx context.Context, mfa models.MFA, code string) (bool, error) {
+	if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+		// Один и тот же код нельзя использовать дважды
+		err := m.Repo.UseStep(ctx, mfa.UserID, step)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	err := m.Repo.UseRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// newRecoveryCodes создает коды восстановления вида "abcde-fghij" и их хеши для хранения
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(buf)[:10])
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// currentUser возвращает пользователя, выполняющего запрос; управлять вторым фактором по API ключу нельзя
+func (m *MFAManager) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	identity, ok := FromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return models.User{}, false
+	}
+	if identity.APIKeyID != 0 {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeAPIKeyNotAllowed, "MFA cannot be managed with an API key")
+		return models.User{}, false
+	}
+	user, err := m.Users.GetByID(r.Context(), identity.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return models.User{}, false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// checkCurrentCode проверяет код подключенного второго фактора текущего пользователя
+func (m *MFAManager) checkCurrentCode(w http.ResponseWriter, r *http.Request, user models.User) (models.MFA, bool) {
+	var request MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+		return models.MFA{}, false
+	}
+	mfa, err := m.Repo.Get(r.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !mfa.Enabled()) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeMFANotEnabled, "MFA is not enabled")
+		return models.MFA{}, false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return models.MFA{}, false
+	}
+	ok, err := m.verifyCode(r.Context(), mfa, request.Code)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return models.MFA{}, false
+	}
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFACode, "Invalid code")
+		return models.MFA{}, false
+	}
+	return mfa, true
+}
+
+// LoginMFA — второй шаг входа со вторым фактором: mfa_token из /api/login и TOTP код или код восстановления
+// обмениваются на токены
+func LoginMFA(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request MFALoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MFAToken == "" || request.Code == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+		userID, err := m.parseChallenge(request.MFAToken)
+		if err != nil {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFAToken, err.Error())
+			return
+		}
+		user, err := m.Users.GetByID(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFAToken, errInvalidChallenge.Error())
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Подбор кода ограничивается так же, как подбор пароля
+		ip := clientIP(r)
+		if !checkLoginAllowed(w, r, m.Guard, user.Username, ip) {
+			return
+		}
+		mfa, err := m.Repo.Get(r.Context(), user.ID)
+		if err != nil || !mfa.Enabled() {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFAToken, errInvalidChallenge.Error())
+			return
+		}
+		ok, err := m.verifyCode(r.Context(), mfa, request.Code)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !ok {
+			if err := m.Guard.Failure(r.Context(), user.Username, ip); err != nil {
+				log.Printf("Error recording failed MFA code for %s: %v", user.Username, err)
+			}
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFACode, "Invalid code")
+			return
+		}
+		if err := m.Guard.Success(r.Context(), user.Username); err != nil {
+			log.Printf("Error resetting failed logins for %s: %v", user.Username, err)
+		}
+
+		tokens, err := m.Sessions.Start(r.Context(), user, r, true)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		writeTokens(w, tokens)
+	}
+}
+
+// EnrollTOTP создает TOTP секрет и otpauth:// URI для QR кода; второй фактор включается только после подтверждения кодом
+func EnrollTOTP(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := m.currentUser(w, r)
+		if !ok {
+			return
+		}
+		enabled, err := m.Enabled(r.Context(), user.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if enabled {
+			problem.Error(w, r, http.StatusConflict, problem.CodeMFAAlreadyEnabled, "MFA already enabled, disable it first")
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.Repo.SaveSecret(r.Context(), user.ID, secret); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(MFAEnrollResponse{
+			Secret:          secret,
+			ProvisioningURI: totp.ProvisioningURI(m.Config.Issuer, user.Username, secret),
+		})
+	}
+}
+
+// ConfirmTOTP включает второй фактор после проверки кода и возвращает коды восстановления, которые показываются
+// один раз. Сессия со вторым фактором выдается при следующем входе.
+func ConfirmTOTP(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := m.currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+
+		mfa, err := m.Repo.Get(r.Context(), user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeMFANotEnabled, "Enrollment not started")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if mfa.Enabled() {
+			problem.Error(w, r, http.StatusConflict, problem.CodeMFAAlreadyEnabled, "MFA already enabled")
+			return
+		}
+		step, valid := totp.Validate(mfa.Secret, request.Code, time.Now())
+		if !valid {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidMFACode, "Invalid code")
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.Repo.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.Repo.Confirm(r.Context(), user.ID, step); errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeMFAAlreadyEnabled, "MFA already enabled")
+			return
+		} else if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления; нужен действующий TOTP код или код восстановления
+func RegenerateRecoveryCodes(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := m.currentUser(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := m.checkCurrentCode(w, r, user); !ok {
+			return
+		}
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.Repo.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// DisableTOTP отключает второй фактор; нужен действующий TOTP код или код восстановления. Все сессии
+// пользователя, включая текущую, завершаются, а API ключи перестают считаться выпущенными со вторым фактором.
+func DisableTOTP(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := m.currentUser(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := m.checkCurrentCode(w, r, user); !ok {
+			return
+		}
+		// Сначала снимаем повышенные права: если это не удалось, второй фактор остается и запрос можно повторить
+		if err := m.dropElevation(r.Context(), user.ID); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.Repo.Disable(r.Context(), user.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ResetUserMFA снимает второй фактор пользователя, потерявшего устройство, и завершает его сессии
+func ResetUserMFA(m *MFAManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+		err = m.Repo.Disable(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeMFANotEnabled, "MFA is not enabled")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := m.dropElevation(r.Context(), userID); err != nil {
+			log.Printf("Error revoking sessions of user %d after MFA reset: %v", userID, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import "testing"
+
+func TestMFAPolicy(t *testing.T) {
+	policy := NewMFAPolicy([]string{"librarian", "admin"})
+
+	cases := []struct {
+		identity  Identity
+		satisfied bool
+	}{
+		{Identity{Role: "patron"}, true},
+		{Identity{Role: "admin"}, false},
+		{Identity{Role: "admin", MFA: true}, true},
+		{Identity{Role: "librarian", APIKeyID: 3}, false},
+		{Identity{Role: "librarian", APIKeyID: 3, MFA: true}, true},
+	}
+	for _, c := range cases {
+		if got := policy.Satisfied(c.identity); got != c.satisfied {
+			t.Errorf("%+v: expected %v, got %v", c.identity, c.satisfied, got)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("Expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected code format %q", code)
+		}
+		// Код принимается с любым регистром, пробелами и без дефиса
+		if hashToken(normalizeRecoveryCode(" "+code[:5]+" "+code[6:]+" ")) != hashes[i] {
+			t.Errorf("Code %q does not match its hash after normalization", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != recoveryCodeCount {
+		t.Error("Expected unique recovery codes")
+	}
+}
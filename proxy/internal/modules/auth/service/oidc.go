@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/oidc"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+// Порядок ролей от меньших прав к большим: при нескольких подходящих группах выбирается старшая роль
+var roleRank = map[string]int{models.RolePatron: 1, models.RoleLibrarian: 2, models.RoleAdmin: 3}
+
+// ParseRoleMap разбирает OIDC_ROLE_MAP вида "группа:роль[,группа:роль...]"
+func ParseRoleMap(spec string) (map[string]string, error) {
+	roleMap := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		separator := strings.LastIndex(pair, ":")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid role mapping %q, expected group:role", pair)
+		}
+		group, role := pair[:separator], pair[separator+1:]
+		if !models.ValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q in mapping for group %q", role, group)
+		}
+		roleMap[group] = role
+	}
+	return roleMap, nil
+}
+
+// MapRole выбирает старшую роль среди групп пользователя; без совпадений — роль по умолчанию
+func MapRole(groups []string, roleMap map[string]string) string {
+	role := models.DefaultRole
+	for _, group := range groups {
+		if mapped, ok := roleMap[group]; ok && roleRank[mapped] > roleRank[role] {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// OIDCLogin выполняет вход через внешнего провайдера и создает локальных пользователей при первом входе
+type OIDCLogin struct {
+	Client     *oidc.Client
+	Users      postgres.UserRepository
+	Identities postgres.ExternalIdentityRepository
+	Sessions   *SessionManager
+	RoleMap    map[string]string // Пустая карта — роли не синхронизируются с провайдером
+
+	// Начатые входы по state; живут в памяти процесса не дольше oidcLoginTTL
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+type pendingLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+func NewOIDCLogin(client *oidc.Client, users postgres.UserRepository, identities postgres.ExternalIdentityRepository,
+	sessions *SessionManager, roleMap map[string]string) *OIDCLogin {
+	return &OIDCLogin{
+		Client:     client,
+		Users:      users,
+		Identities: identities,
+		Sessions:   sessions,
+		RoleMap:    roleMap,
+		pending:    make(map[string]pendingLogin),
+	}
+}
+
+func (l *OIDCLogin) begin() (state string, login pendingLogin, err error) {
+	if state, err = oidc.RandomString(); err != nil {
+		return "", pendingLogin{}, err
+	}
+	if login.nonce, err = oidc.RandomString(); err != nil {
+		return "", pendingLogin{}, err
+	}
+	if login.verifier, err = oidc.RandomString(); err != nil {
+		return "", pendingLogin{}, err
+	}
+	login.expiresAt = time.Now().Add(oidcLoginTTL)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, p := range l.pending {
+		if time.Now().After(p.expiresAt) {
+			delete(l.pending, key)
+		}
+	}
+	l.pending[state] = login
+	return state, login, nil
+}
+
+// finish возвращает начатый вход; каждый state принимается один раз
+func (l *OIDCLogin) finish(state string) (pendingLogin, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	login, ok := l.pending[state]
+	delete(l.pending, state)
+	if !ok || time.Now().After(login.expiresAt) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+// resolveUser находит пользователя, связанного с учетной записью провайдера, или создает его
+func (l *OIDCLogin) resolveUser(ctx context.Context, claims oidc.Claims) (models.User, error) {
+	issuer := l.Client.Issuer()
+
+	var user models.User
+	userID, err := l.Identities.GetUserID(ctx, issuer, claims.Subject)
+	switch {
+	case err == nil:
+		if user, err = l.Users.GetByID(ctx, strconv.Itoa(userID)); err != nil {
+			return models.User{}, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if user, err = l.provision(ctx, claims); err != nil {
+			return models.User{}, err
+		}
+		if err := l.Identities.Link(ctx, issuer, claims.Subject, user.ID); err != nil {
+			return models.User{}, err
+		}
+	default:
+		return models.User{}, err
+	}
+
+	// Провайдер — источник истины для ролей, если задано соответствие групп
+	if len(l.RoleMap) > 0 {
+		if role := MapRole(claims.Groups, l.RoleMap); role != user.Role {
+			user.Role = role
+			if err := l.Users.Update(ctx, user); err != nil {
+				return models.User{}, err
+			}
+		}
+	}
+	return user, nil
+}
+
+// provision связывает вход с существующей учетной записью, если у обеих сторон подтвержден один и тот же адрес,
+// иначе создает нового пользователя без пароля
+func (l *OIDCLogin) provision(ctx context.Context, claims oidc.Claims) (models.User, error) {
+	if claims.EmailVerified && claims.Email != "" {
+		existing, err := l.Users.ListByEmail(ctx, claims.Email)
+		if err != nil {
+			return models.User{}, err
+		}
+		if len(existing) == 1 && existing[0].EmailVerified {
+			return existing[0], nil
+		}
+	}
+
+	username, err := l.freeUsername(ctx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		name = string([]rune(name)[:50])
+	}
+	user := models.User{
+		Username: username,
+		Name:     name,
+		Email:    claims.Email,
+		Role:     MapRole(claims.Groups, l.RoleMap),
+	}
+	if user.ID, err = l.Users.Create(ctx, user); err != nil {
+		return models.User{}, err
+	}
+	if claims.EmailVerified && claims.Email != "" {
+		if err := l.Users.MarkEmailVerified(ctx, user.ID, user.Email); err == nil {
+			user.EmailVerified = true
+		}
+	}
+	return user, nil
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// freeUsername строит логин из preferred_username или адреса и добавляет номер, если логин занят
+func (l *OIDCLogin) freeUsername(ctx context.Context, claims oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		_, err := l.Users.GetByUsername(ctx, candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("no free username for " + base)
+}
+
+// OIDCStart перенаправляет к провайдеру OpenID Connect (authorization code flow с PKCE)
+func OIDCStart(login *OIDCLogin) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, pending, err := login.begin()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		// Cookie привязывает state к браузеру, начавшему вход, и защищает от подмены входа (login CSRF)
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/api/oidc",
+			MaxAge:   int(oidcLoginTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, login.Client.AuthCodeURL(state, pending.nonce, pending.verifier), http.StatusFound)
+	}
+}
+
+// OIDCCallback обменивает код провайдера на ID токен, проверяет его, создает или обновляет локального пользователя
+// и выдает токены, как /api/login
+func OIDCCallback(login *OIDCLogin) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/oidc", MaxAge: -1})
+
+		if providerError := query.Get("error"); providerError != "" {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeLoginRejected, "Login rejected by the identity provider: "+providerError)
+			return
+		}
+		state := query.Get("state")
+		cookie, err := r.Cookie(oidcStateCookie)
+		if state == "" || err != nil || cookie.Value != state {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidLoginState, "Invalid login attempt")
+			return
+		}
+		pending, ok := login.finish(state)
+		if !ok {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidLoginState, "Login attempt expired, start again")
+			return
+		}
+
+		idToken, err := login.Client.Exchange(r.Context(), query.Get("code"), pending.verifier)
+		if err != nil {
+			log.Printf("OIDC code exchange failed: %v", err)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeLoginRejected, "Login rejected by the identity provider")
+			return
+		}
+		claims, err := login.Client.VerifyIDToken(r.Context(), idToken, pending.nonce)
+		if err != nil {
+			log.Printf("OIDC ID token rejected: %v", err)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeLoginRejected, "Invalid ID token")
+			return
+		}
+
+		user, err := login.resolveUser(r.Context(), claims)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Связанный пользователь удален
+			problem.Error(w, r, http.StatusForbidden, problem.CodeAccountDisabled, "Account disabled")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, fmt.Errorf("OIDC user provisioning: %w", err))
+			return
+		}
+
+		tokens, err := login.Sessions.Start(r.Context(), user, r, claims.HasMFA())
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import "testing"
+
+func TestRoleMapping(t *testing.T) {
+	roleMap, err := ParseRoleMap("library-staff:librarian, it:admin:admin ,students:patron")
+	if err != nil {
+		t.Fatalf("Expected valid mapping, got %v", err)
+	}
+	if roleMap["it:admin"] != "admin" || roleMap["library-staff"] != "librarian" {
+		t.Errorf("Unexpected mapping %v", roleMap)
+	}
+	if _, err := ParseRoleMap("staff:superuser"); err == nil {
+		t.Error("Expected unknown role to be rejected")
+	}
+
+	cases := []struct {
+		groups []string
+		role   string
+	}{
+		{nil, "patron"},
+		{[]string{"students"}, "patron"},
+		{[]string{"students", "library-staff"}, "librarian"},
+		{[]string{"it:admin", "library-staff"}, "admin"},
+		{[]string{"unknown"}, "patron"},
+	}
+	for _, c := range cases {
+		if role := MapRole(c.groups, roleMap); role != c.role {
+			t.Errorf("groups %v: expected %s, got %s", c.groups, c.role, role)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import "studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+
+// Permission описывает действие, доступ к которому проверяется по роли пользователя
+type Permission string
+
+const (
+	PermLoansOwn      Permission = "loans:own"       // Взять и вернуть свою книгу
+	PermLoansOnBehalf Permission = "loans:on_behalf" // Выдать и принять книгу за читателя
+	PermLoansRenew    Permission = "loans:renew"     // Продлить выдачу книги
+	PermBooksWrite    Permission = "books:write"     // Добавлять, изменять и удалять книги и авторов
+	PermUsersManage   Permission = "users:manage"    // Управлять учетными записями пользователей
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RolePatron:    {PermLoansOwn, PermLoansRenew},
+	models.RoleLibrarian: {PermLoansOwn, PermLoansOnBehalf, PermLoansRenew, PermBooksWrite},
+	models.RoleAdmin:     {PermLoansOwn, PermLoansOnBehalf, PermLoansRenew, PermBooksWrite, PermUsersManage},
+}
+
+// HasPermission проверяет, разрешено ли роли действие
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPermission проверяет, что право известно системе
+func ValidPermission(perm Permission) bool {
+	return HasPermission(models.RoleAdmin, perm)
+}
+
+// Can проверяет право пользователя, выполняющего запрос.
+// Запрос по API ключу ограничен и ролью владельца, и областями ключа.
+func (i Identity) Can(perm Permission) bool {
+	if !HasPermission(i.Role, perm) {
+		return false
+	}
+	if i.APIKeyID == 0 {
+		return true
+	}
+	for _, scope := range i.Scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
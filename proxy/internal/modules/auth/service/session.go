@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+// RevocationCache кеширует в памяти процесса результат проверки отзыва сессий,
+// чтобы не обращаться к базе данных на каждый запрос
+type RevocationCache struct {
+	repo    postgres.SessionRepository
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+}
+
+type revocationEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+func NewRevocationCache(repo postgres.SessionRepository, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{repo: repo, ttl: ttl, entries: make(map[string]revocationEntry)}
+}
+
+// IsRevoked проверяет сессию, обращаясь к базе не чаще одного раза за ttl. Запись старше ttl удаляется
+// и проверяется заново; отозванная сессия остается отозванной в базе, поэтому результат не меняется.
+func (c *RevocationCache) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[sessionID]
+	if ok && time.Since(entry.checkedAt) >= c.ttl {
+		delete(c.entries, sessionID)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.repo.IsRevoked(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.entries[sessionID] = revocationEntry{revoked: revoked, checkedAt: time.Now()}
+	c.mu.Unlock()
+	return revoked, nil
+}
+
+// MarkRevoked сразу отражает в кеше отзыв сессий, выполненный этим процессом
+func (c *RevocationCache) MarkRevoked(sessionIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range sessionIDs {
+		c.entries[id] = revocationEntry{revoked: true, checkedAt: time.Now()}
+	}
+}
+
+// Sweep удаляет записи старше ttl, в том числе сессий, о которых больше не спрашивают
+func (c *RevocationCache) Sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if time.Since(entry.checkedAt) >= c.ttl {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// StartSweeper вызывает Sweep раз в interval, пока не отменен ctx
+func (c *RevocationCache) StartSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sweep()
+		}
+	}
+}
+
+// SessionManager выдает пары токенов доступа и обновления и управляет сессиями
+type SessionManager struct {
+	Repo        postgres.SessionRepository
+	Revocations *RevocationCache
+	AccessTTL   time.Duration
+	RefreshTTL  time.Duration
+}
+
+func NewSessionManager(repo postgres.SessionRepository, accessTTL, refreshTTL time.Duration) *SessionManager {
+	return &SessionManager{
+		Repo:        repo,
+		Revocations: NewRevocationCache(repo, 30*time.Second),
+		AccessTTL:   accessTTL,
+		RefreshTTL:  refreshTTL,
+	}
+}
+
+// Start открывает новую сессию пользователя и выдает для нее токены; mfa отмечает вход со вторым фактором
+func (m *SessionManager) Start(ctx context.Context, user models.User, r *http.Request, mfa bool) (TokenResponse, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	session := models.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: truncate(r.UserAgent(), 255),
+		IP:        clientIP(r),
+		MFA:       mfa,
+	}
+	if err := m.Repo.Create(ctx, session, hashToken(refreshToken), time.Now().Add(m.RefreshTTL)); err != nil {
+		return TokenResponse{}, err
+	}
+	return m.tokens(user, session, refreshToken)
+}
+
+// Refresh обменивает токен обновления на новую пару токенов
+func (m *SessionManager) Refresh(ctx context.Context, userRepo postgres.UserRepository, refreshToken string) (TokenResponse, error) {
+	newRefreshToken, err := randomToken(32)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	session, err := m.Repo.Rotate(ctx, hashToken(refreshToken), hashToken(newRefreshToken), time.Now().Add(m.RefreshTTL))
+	if errors.Is(err, postgres.ErrRefreshTokenReused) && session.ID != "" {
+		m.Revocations.MarkRevoked(session.ID)
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	// Роль и логин берутся из базы, чтобы изменения вступали в силу при обновлении токена
+	user, err := userRepo.GetByID(ctx, strconv.Itoa(session.UserID))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return m.tokens(user, session, newRefreshToken)
+}
+
+// Revoke закрывает одну сессию
+func (m *SessionManager) Revoke(ctx context.Context, sessionID string) error {
+	if err := m.Repo.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	m.Revocations.MarkRevoked(sessionID)
+	return nil
+}
+
+// RevokeAll закрывает все сессии пользователя
+func (m *SessionManager) RevokeAll(ctx context.Context, userID int) error {
+	ids, err := m.Repo.RevokeAllForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	m.Revocations.MarkRevoked(ids...)
+	return nil
+}
+
+// RevokeForUser закрывает одну сессию пользователя
+func (m *SessionManager) RevokeForUser(ctx context.Context, userID int, sessionID string) error {
+	if err := m.Repo.RevokeForUser(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	m.Revocations.MarkRevoked(sessionID)
+	return nil
+}
+
+func (m *SessionManager) tokens(user models.User, session models.Session, refreshToken string) (TokenResponse, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	claims := map[string]interface{}{
+		"user_id":  strconv.Itoa(user.ID),
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      session.ID,
+		"mfa":      session.MFA,
+		"jti":      jti,
+		"exp":      time.Now().Add(m.AccessTTL).Unix(),
+	}
+	_, accessToken, err := TokenAuth.Encode(claims)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		Token:        accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(m.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// RefreshHandler обменивает токен обновления на новую пару токенов; повторное использование токена завершает сессию
+func RefreshHandler(userRepo postgres.UserRepository, sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid request")
+			return
+		}
+
+		tokens, err := sessions.Refresh(r.Context(), userRepo, request.RefreshToken)
+		switch {
+		case errors.Is(err, postgres.ErrRefreshTokenReused):
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeRefreshTokenReused, "Refresh token reuse detected, session revoked")
+			return
+		case errors.Is(err, postgres.ErrRefreshTokenExpired), errors.Is(err, postgres.ErrSessionRevoked), errors.Is(err, sql.ErrNoRows):
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid refresh token")
+			return
+		case err != nil:
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+// Logout завершает сессию текущего токена доступа
+func Logout(sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromContext(r.Context())
+		if !ok || identity.SessionID == "" {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		if err := sessions.Revoke(r.Context(), identity.SessionID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LogoutAll завершает все сессии пользователя на всех устройствах
+func LogoutAll(sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromContext(r.Context())
+		if !ok {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		userID, err := strconv.Atoi(identity.UserID)
+		if err != nil {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		if err := sessions.RevokeAll(r.Context(), userID); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListSessions возвращает активные сессии пользователя; доступно самому пользователю и администраторам
+func ListSessions(sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+		list, err := sessions.Repo.ListActiveForUser(r.Context(), userID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		identity, _ := FromContext(r.Context())
+		response := make([]SessionResponse, 0, len(list))
+		for _, session := range list {
+			response = append(response, SessionResponse{Session: session, Current: session.ID == identity.SessionID})
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RevokeSessions завершает одну сессию пользователя (если задан sessionID) или все; их токены доступа перестают работать
+func RevokeSessions(sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+
+		if sessionID := chi.URLParam(r, "sessionID"); sessionID != "" {
+			err = sessions.RevokeForUser(r.Context(), userID, sessionID)
+		} else {
+			err = sessions.RevokeAll(r.Context(), userID)
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			problem.Error(w, r, http.StatusNotFound, problem.CodeSessionNotFound, "Session not found")
+			return
+		case err != nil:
+			problem.Internal(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken возвращает SHA-256 токена; в базе хранятся только хеши
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "")
+}
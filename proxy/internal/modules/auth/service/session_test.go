@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
+)
+
+type revocationRepo struct {
+	postgres.SessionRepository
+	revoked map[string]bool
+	lookups int
+}
+
+func (r *revocationRepo) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	r.lookups++
+	return r.revoked[sessionID], nil
+}
+
+func TestRevocationCacheExpiresEntries(t *testing.T) {
+	repo := &revocationRepo{revoked: map[string]bool{"old": true}}
+	cache := NewRevocationCache(repo, time.Minute)
+
+	for _, id := range []string{"old", "old", "new"} {
+		if _, err := cache.IsRevoked(context.Background(), id); err != nil {
+			t.Fatalf("IsRevoked(%s): %v", id, err)
+		}
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("Expected 2 lookups, got %d", repo.lookups)
+	}
+
+	// Запись старше ttl удаляется при обращении и проверяется в базе заново
+	cache.entries["old"] = revocationEntry{revoked: true, checkedAt: time.Now().Add(-2 * time.Minute)}
+	if revoked, _ := cache.IsRevoked(context.Background(), "old"); !revoked || repo.lookups != 3 {
+		t.Errorf("Expected stale entry to be rechecked, revoked=%v lookups=%d", revoked, repo.lookups)
+	}
+
+	cache.entries["new"] = revocationEntry{checkedAt: time.Now().Add(-2 * time.Minute)}
+	cache.entries["gone"] = revocationEntry{revoked: true, checkedAt: time.Now().Add(-time.Hour)}
+	cache.Sweep()
+	if len(cache.entries) != 1 {
+		t.Errorf("Expected only the fresh entry after Sweep, got %v", cache.entries)
+	}
+}
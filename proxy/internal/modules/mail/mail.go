@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+)
+
+// Message — текстовое письмо одному получателю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender отправляет письма
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender возвращает SMTP отправителя или, если SMTP не настроен, очередь в памяти,
+// которая выводит письма в журнал для локальной разработки
+func NewSender(cfg config.MailConfig) Sender {
+	if cfg.SMTPAddr == "" {
+		log.Println("SMTP_ADDR not set, mail is kept in the in-memory outbox")
+		outbox := NewOutbox()
+		outbox.Log = true
+		return outbox
+	}
+	return NewSMTPSender(cfg)
+}
+
+// SMTPSender отправляет письма через SMTP сервер
+type SMTPSender struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTPSender(cfg config.MailConfig) *SMTPSender {
+	sender := &SMTPSender{Addr: cfg.SMTPAddr, From: cfg.From}
+	if cfg.SMTPUsername != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+		sender.Auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+	}
+	return sender
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{msg.To}, data)
+}
+
+var errHeaderInjection = errors.New("mail header contains line break")
+
+// buildMessage собирает письмо в формате RFC 5322 с телом в UTF-8
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errHeaderInjection
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
+
+// Outbox хранит письма в памяти вместо отправки; используется в тестах и при локальной разработке
+type Outbox struct {
+	Log bool // Выводить письма в журнал
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	o.messages = append(o.messages, msg)
+	o.mu.Unlock()
+	if o.Log {
+		log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	}
+	return nil
+}
+
+// Messages возвращает копию всех отправленных писем
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// Last возвращает последнее письмо указанному получателю
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
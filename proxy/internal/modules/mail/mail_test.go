@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	data, err := buildMessage("library@example.com", Message{
+		To:      "reader@example.com",
+		Subject: "Подтверждение адреса",
+		Body:    "line one\nline two",
+	}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	text := string(data)
+	for _, expected := range []string{
+		"To: reader@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected message to contain %q, got %q", expected, text)
+		}
+	}
+
+	_, err = buildMessage("library@example.com", Message{To: "reader@example.com\r\nBcc: x@example.com"}, time.Now())
+	if err != errHeaderInjection {
+		t.Errorf("Expected header injection error, got %v", err)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	outbox := NewOutbox()
+	outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "first"})
+	outbox.Send(context.Background(), Message{To: "b@example.com", Subject: "other"})
+	outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "second"})
+
+	if len(outbox.Messages()) != 3 {
+		t.Errorf("Expected 3 messages, got %d", len(outbox.Messages()))
+	}
+	if msg, ok := outbox.Last("a@example.com"); !ok || msg.Subject != "second" {
+		t.Errorf("Expected last message to a@example.com to be %q, got %+v", "second", msg)
+	}
+	if _, ok := outbox.Last("c@example.com"); ok {
+		t.Error("Expected no message to c@example.com")
+	}
+}
@@ -0,0 +1,319 @@
+package negotiate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Значение после разбора JSON: nil, bool, json.Number, string, []interface{} или object.
+// Объект хранит поля в исходном порядке, чтобы колонки CSV и элементы XML шли как поля структуры.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func decodeTree(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return token, nil
+}
+
+// writeCSV пишет список строками таблицы, а один объект — одной строкой. Колонки — поля элементов;
+// вложенные объекты и списки записываются в ячейку как JSON. Для пустого списка структур
+// колонки берутся из типа, поэтому заголовок есть всегда.
+func writeCSV(body *bytes.Buffer, tree interface{}, v interface{}) error {
+	rows, ok := tree.([]interface{})
+	if !ok {
+		rows = []interface{}{tree}
+	}
+
+	columns := structColumns(reflect.TypeOf(v))
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		seen[column] = true
+	}
+	for _, row := range rows {
+		obj, ok := row.(object)
+		if !ok {
+			if !seen["value"] {
+				seen["value"] = true
+				columns = append(columns, "value")
+			}
+			continue
+		}
+		for _, m := range obj {
+			if !seen[m.key] {
+				seen[m.key] = true
+				columns = append(columns, m.key)
+			}
+		}
+	}
+
+	out := csv.NewWriter(body)
+	if len(columns) > 0 {
+		out.Write(columns)
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		obj, ok := row.(object)
+		if !ok {
+			obj = object{{key: "value", value: row}}
+		}
+		for _, m := range obj {
+			for i, column := range columns {
+				if column == m.key {
+					record[i] = cell(m.value)
+				}
+			}
+		}
+		out.Write(record)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// structColumns возвращает JSON имена полей, если v — срез или массив структур
+func structColumns(t reflect.Type) []string {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return nil
+	}
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+	return fieldNames(elem)
+}
+
+func fieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			names = append(names, fieldNames(field.Type)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func cell(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		if value {
+			return "true"
+		}
+		return "false"
+	}
+	var nested bytes.Buffer
+	writeJSON(&nested, value)
+	return nested.String()
+}
+
+// writeJSON восстанавливает JSON из разобранного значения, сохраняя порядок полей
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case object:
+		buf.WriteByte('{')
+		for i, m := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(m.key)
+			buf.Write(key)
+			buf.WriteByte(':')
+			writeJSON(buf, m.value)
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, item)
+		}
+		buf.WriteByte(']')
+	default:
+		scalar, _ := json.Marshal(value)
+		buf.Write(scalar)
+	}
+}
+
+// writeXML пишет список как <items><item>...</item></items>, объект — как <item>, поля — элементами
+// с именами JSON полей. Ключи, которые не годятся в имя элемента (например числовые ключи map),
+// записываются как <entry key="...">. null пропускается.
+func writeXML(body *bytes.Buffer, tree interface{}) error {
+	body.WriteString(xml.Header)
+	enc := xml.NewEncoder(body)
+	name := "item"
+	if _, ok := tree.([]interface{}); ok {
+		name = "items"
+	}
+	if err := xmlElement(enc, name, tree); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func xmlElement(enc *xml.Encoder, name string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case object:
+		for _, m := range value {
+			if err := xmlElement(enc, m.key, m.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := xmlElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(cell(value))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName проверяет, что ключ можно использовать как имя элемента без экранирования
+func xmlName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || !(r == '-' || r == '.' || (r >= '0' && r <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeMessagePack кодирует значение в MessagePack: целые числа — в самый короткий целый формат,
+// дробные — в float 64, объекты — в map с ключами в порядке полей
+func writeMessagePack(body *bytes.Buffer, value interface{}) error {
+	return encodeMessagePack(msgpack.NewEncoder(body), value)
+}
+
+func encodeMessagePack(enc *msgpack.Encoder, value interface{}) error {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return enc.EncodeInt(n)
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		return enc.EncodeFloat64(f)
+	case []interface{}:
+		if err := enc.EncodeArrayLen(len(value)); err != nil {
+			return err
+		}
+		for _, item := range value {
+			if err := encodeMessagePack(enc, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case object:
+		if err := enc.EncodeMapLen(len(value)); err != nil {
+			return err
+		}
+		for _, m := range value {
+			if err := enc.EncodeString(m.key); err != nil {
+				return err
+			}
+			if err := encodeMessagePack(enc, m.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		// nil, bool и string
+		return enc.Encode(value)
+	}
+}
@@ -0,0 +1,193 @@
+// Package negotiate выбирает формат ответа по заголовку Accept и кодирует в него тело.
+// Поддерживаются JSON (по умолчанию), CSV, XML и MessagePack. Все форматы строятся из JSON
+// представления значения, поэтому имена полей и omitempty совпадают с JSON ответом.
+package negotiate
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// Форматы ответа
+const (
+	JSON        = "application/json"
+	CSV         = "text/csv"
+	XML         = "application/xml"
+	MessagePack = "application/msgpack"
+)
+
+// Types — форматы в порядке предпочтения сервера: при равном q выбирается более ранний
+var Types = []string{JSON, CSV, XML, MessagePack}
+
+// aliases — другие распространенные названия тех же форматов; ответ отдается с типом, который просил клиент
+var aliases = map[string]string{
+	"text/xml":                XML,
+	"application/x-msgpack":   MessagePack,
+	"application/vnd.msgpack": MessagePack,
+}
+
+var contentTypes = map[string]string{
+	JSON:        "application/json;charset=utf-8",
+	CSV:         "text/csv;charset=utf-8",
+	XML:         "application/xml;charset=utf-8",
+	MessagePack: "application/msgpack",
+}
+
+// Select возвращает тип ответа для заголовка Accept. Пустой заголовок означает JSON;
+// false — ни один из поддерживаемых форматов не подходит.
+func Select(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+	ranges := parseAccept(accept)
+
+	best, bestQ, bestOrder := "", 0.0, 0
+	for _, media := range Offered() {
+		q, ok := quality(ranges, media)
+		if !ok || q <= 0 {
+			continue
+		}
+		order := preference(media)
+		if q > bestQ || (q == bestQ && order < bestOrder) {
+			best, bestQ, bestOrder = media, q, order
+		}
+	}
+	return best, best != ""
+}
+
+// Offered возвращает все типы ответа, которые можно запросить, включая псевдонимы
+func Offered() []string {
+	var names []string
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return append(append([]string{}, Types...), names...)
+}
+
+// Write отвечает статусом status и телом v в формате, выбранном по Accept. Тело кодируется до отправки
+// заголовков, поэтому при ошибке записан только Vary: для неподходящего Accept возвращается 406 *problem.Problem.
+func Write(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	// Ответ зависит от Accept при любом исходе, включая 406 и ошибку кодирования: иначе кэш отдаст
+	// ошибку клиенту, который просил другой формат
+	w.Header().Add("Vary", "Accept")
+	media, ok := Select(r.Header.Get("Accept"))
+	if !ok {
+		return problem.New(http.StatusNotAcceptable, problem.CodeNotAcceptable,
+			"supported response types: "+strings.Join(Types, ", "))
+	}
+	format := canonical(media)
+
+	var body bytes.Buffer
+	if format == JSON {
+		// JSON отдается тем же кодировщиком, что и без согласования
+		if err := json.NewEncoder(&body).Encode(v); err != nil {
+			return err
+		}
+	} else if err := encode(&body, format, v); err != nil {
+		return err
+	}
+
+	contentType := contentTypes[format]
+	if media != format {
+		contentType = strings.Replace(contentType, format, media, 1)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+	return nil
+}
+
+func encode(body *bytes.Buffer, format string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tree, err := decodeTree(raw)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case CSV:
+		return writeCSV(body, tree, v)
+	case XML:
+		return writeXML(body, tree)
+	default:
+		return writeMessagePack(body, tree)
+	}
+}
+
+func canonical(media string) string {
+	if format, ok := aliases[media]; ok {
+		return format
+	}
+	return media
+}
+
+// preference — место формата в Types; псевдоним стоит сразу за основным названием
+func preference(media string) int {
+	format := canonical(media)
+	for i, t := range Types {
+		if t == format {
+			if format != media {
+				return 2*i + 1
+			}
+			return 2 * i
+		}
+	}
+	return 2 * len(Types)
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// quality возвращает q самого точного диапазона Accept, под который подходит media
+func quality(ranges []mediaRange, media string) (float64, bool) {
+	typ, subtype, _ := strings.Cut(media, "/")
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q, specificity >= 0
+}
@@ -0,0 +1,148 @@
+package negotiate
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type book struct {
+	Index     int     `json:"index"`
+	Book      string  `json:"book"`
+	Block     *bool   `json:"block"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
+}
+
+func TestSelect(t *testing.T) {
+	cases := map[string]string{
+		"":                                  JSON,
+		"*/*":                               JSON,
+		"application/*":                     JSON,
+		"text/*":                            CSV,
+		"text/csv":                          CSV,
+		"application/xml;q=0.5, text/csv":   CSV,
+		"application/xml, text/csv;q=0.9":   XML,
+		"text/xml":                          "text/xml",
+		"application/x-msgpack":             "application/x-msgpack",
+		"application/msgpack, */*;q=0.1":    MessagePack,
+		"text/html, application/json;q=0.8": JSON,
+		"application/json;q=0, */*":         CSV,
+	}
+	for accept, want := range cases {
+		if got, ok := Select(accept); !ok || got != want {
+			t.Errorf("Select(%q) = %q, %v; want %q", accept, got, ok, want)
+		}
+	}
+	for _, accept := range []string{"text/html", "image/png, application/pdf", "application/json;q=0"} {
+		if got, ok := Select(accept); ok {
+			t.Errorf("Select(%q) = %q, want not acceptable", accept, got)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	free := false
+	books := []book{{Index: 1, Book: `Tom "Sawyer", 1876`, Block: &free}, {Index: 2, Book: "Dune <I>"}}
+
+	cases := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/json;charset=utf-8", `[{"index":1,"book":"Tom \"Sawyer\", 1876","block":false},{"index":2,"book":"Dune \u003cI\u003e","block":null}]` + "\n"},
+		{"text/csv", "text/csv;charset=utf-8", "index,book,block,deleted_at\n1,\"Tom \"\"Sawyer\"\", 1876\",false,\n2,Dune <I>,,\n"},
+		{"text/xml", "text/xml;charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<items><item><index>1</index><book>Tom &#34;Sawyer&#34;, 1876</book><block>false</block></item>` +
+			`<item><index>2</index><book>Dune &lt;I&gt;</book></item></items>`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/books", nil)
+		req.Header.Set("Accept", c.accept)
+		rr := httptest.NewRecorder()
+		if err := Write(rr, req, http.StatusOK, books); err != nil {
+			t.Fatalf("Accept %q: %v", c.accept, err)
+		}
+		if got := rr.Header().Get("Content-Type"); got != c.contentType {
+			t.Errorf("Accept %q: Content-Type = %q", c.accept, got)
+		}
+		if rr.Body.String() != c.body {
+			t.Errorf("Accept %q: body =\n%s\nwant\n%s", c.accept, rr.Body, c.body)
+		}
+	}
+
+	// Пустой список в CSV — только заголовок
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/books", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr := httptest.NewRecorder()
+	Write(rr, req, http.StatusOK, []book{})
+	if rr.Body.String() != "index,book,block,deleted_at\n" {
+		t.Errorf("empty CSV = %q", rr.Body)
+	}
+
+	req.Header.Set("Accept", "text/html")
+	rr = httptest.NewRecorder()
+	if err := Write(rr, req, http.StatusOK, books); err == nil || rr.Body.Len() != 0 {
+		t.Errorf("Expected 406 error without a body, got %v and %q", err, rr.Body)
+	}
+	if got := rr.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Expected Vary: Accept on 406, got %q", got)
+	}
+}
+
+func TestMessagePack(t *testing.T) {
+	long := strings.Repeat("книга", 60)
+	many := make([]int, 70000)
+	cases := []string{
+		`[{"index":1,"book":"Dune","block":null,"take_count":300,"n":-1,"x":1.5}]`,
+		`{"nested":{"list":[true,false,null],"empty":{},"none":[]},"s":"` + long + `"}`,
+		`[-129,-32769,-2147483649,255,65536,4294967296,9223372036854775807,-9223372036854775808,1e+300,-0.25]`,
+	}
+	raw, _ := json.Marshal(many)
+	cases = append(cases, string(raw))
+	for _, c := range cases {
+		tree, err := decodeTree([]byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		if err := writeMessagePack(&body, tree); err != nil {
+			t.Fatal(err)
+		}
+
+		// Декодированное значение совпадает с исходным JSON
+		var decoded interface{}
+		if err := msgpack.Unmarshal(body.Bytes(), &decoded); err != nil {
+			t.Fatalf("decoding %.40s: %v", c, err)
+		}
+		var want interface{}
+		wantDec := json.NewDecoder(strings.NewReader(c))
+		wantDec.UseNumber() // float64 не вмещает границы int64
+		wantDec.Decode(&want)
+		got, _ := json.Marshal(decoded)
+		wantJSON, _ := json.Marshal(want)
+		if !bytes.Equal(got, wantJSON) {
+			t.Errorf("round trip of %.40s = %.80s", c, got)
+		}
+	}
+
+	// Ключи объекта идут в порядке полей
+	var body bytes.Buffer
+	tree, _ := decodeTree([]byte(`{"z":1,"a":2,"m":3}`))
+	writeMessagePack(&body, tree)
+	dec := msgpack.NewDecoder(&body)
+	n, _ := dec.DecodeMapLen()
+	var keys []string
+	for i := 0; i < n; i++ {
+		key, _ := dec.DecodeString()
+		dec.Skip()
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ",") != "z,a,m" {
+		t.Errorf("keys = %v, want z,a,m", keys)
+	}
+}
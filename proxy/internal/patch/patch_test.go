@@ -0,0 +1,73 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSON(t *testing.T, got []byte, expected string) {
+	t.Helper()
+	var g, e interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("invalid expectation %s: %v", expected, err)
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	doc := []byte(`{"index":1,"book":"Old","author":"A","block":false,"meta":{"a":1,"b":2}}`)
+	got, err := MergePatch(doc, []byte(`{"book":"New","meta":{"a":null,"c":3}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertJSON(t, got, `{"index":1,"book":"New","author":"A","block":false,"meta":{"b":2,"c":3}}`)
+}
+
+func TestJSONPatch(t *testing.T) {
+	doc := []byte(`{"book":"Old","author":"A","tags":["x","y"]}`)
+	ops := []byte(`[
+		{"op":"test","path":"/book","value":"Old"},
+		{"op":"replace","path":"/book","value":"New"},
+		{"op":"add","path":"/tags/1","value":"z"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/author","path":"/editor"},
+		{"op":"move","from":"/editor","path":"/translator"}
+	]`)
+	got, err := JSONPatch(doc, ops)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertJSON(t, got, `{"book":"New","author":"A","translator":"A","tags":["z","y"]}`)
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	doc := []byte(`{"book":"Old"}`)
+	if _, err := JSONPatch(doc, []byte(`[{"op":"test","path":"/book","value":"Other"}]`)); !errors.Is(err, ErrTestFailed) {
+		t.Errorf("Expected ErrTestFailed, got %v", err)
+	}
+	if _, err := JSONPatch(doc, []byte(`[{"op":"remove","path":"/missing"}]`)); err == nil {
+		t.Error("Expected error for missing path")
+	}
+	if _, err := JSONPatch(doc, []byte(`[{"op":"replace","path":"/book"}]`)); err == nil {
+		t.Error("Expected error for missing value")
+	}
+}
+
+func TestApplyContentType(t *testing.T) {
+	doc := []byte(`{"book":"Old"}`)
+	if _, err := Apply("application/json", doc, []byte(`{}`)); !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Errorf("Expected ErrUnsupportedMediaType, got %v", err)
+	}
+	got, err := Apply("application/merge-patch+json; charset=utf-8", doc, []byte(`{"book":"New"}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertJSON(t, got, `{"book":"New"}`)
+}
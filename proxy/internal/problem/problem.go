@@ -0,0 +1,194 @@
+// Package problem описывает ошибки API в формате RFC 7807 (application/problem+json).
+// Каждая ошибка несет стабильный машиночитаемый код, необязательный список ошибок полей
+// и идентификатор запроса, по которому ее можно найти в логах.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// RequestIDHeader передает идентификатор запроса клиенту и принимается от прокси
+const RequestIDHeader = "X-Request-Id"
+
+// Коды ошибок. Клиенты опираются на них, а не на текст detail, поэтому существующие коды не меняются.
+const (
+	CodeInvalidRequest       = "invalid_request"        // Тело запроса не разобрано или не заполнено
+	CodeValidation           = "validation_failed"      // Поля не прошли проверку, подробности в errors
+	CodeInvalidParameter     = "invalid_parameter"      // Неверный параметр пути или запроса
+	CodeReadOnlyField        = "read_only_field"        // Попытка изменить поле, которое меняет только сервер
+	CodeUnauthorized         = "unauthorized"           // Нет учетных данных или они недействительны
+	CodeInvalidCredentials   = "invalid_credentials"    // Неверный логин или пароль
+	CodeInvalidToken         = "invalid_token"          // Токен недействителен, истек или уже использован
+	CodeRefreshTokenReused   = "refresh_token_reused"   // Повторное использование refresh токена, сессия отозвана
+	CodeInvalidMFAToken      = "invalid_mfa_token"      // Токен второго шага входа недействителен или истек
+	CodeInvalidMFACode       = "invalid_mfa_code"       // Неверный TOTP код или код восстановления
+	CodeLoginRejected        = "login_rejected"         // Внешний провайдер отклонил вход
+	CodeInvalidLoginState    = "invalid_login_state"    // Вход через провайдера не начат или истек
+	CodeForbidden            = "forbidden"              // Недостаточно прав
+	CodeMFARequired          = "mfa_required"           // Роль требует входа со вторым фактором
+	CodeAPIKeyNotAllowed     = "api_key_not_allowed"    // Операция недоступна при входе по API ключу
+	CodeAccountDisabled      = "account_disabled"       // Учетная запись удалена или отключена
+	CodeMustChangePassword   = "must_change_password"   // Пароль, заданный при развертывании, нужно сменить
+	CodeNotFound             = "not_found"              // Ресурс не найден
+	CodeBookNotFound         = "book_not_found"         // Книга не найдена
+	CodeUserNotFound         = "user_not_found"         // Пользователь не найден
+	CodeSessionNotFound      = "session_not_found"      // Сессия не найдена
+	CodeAPIKeyNotFound       = "api_key_not_found"      // API ключ не найден
+	CodeHoldNotFound         = "hold_not_found"         // У читателя нет брони на книгу
+	CodeMFANotEnabled        = "mfa_not_enabled"        // Второй фактор не подключен или подключение не начато
+	CodeConflict             = "conflict"               // Состояние ресурса не позволяет выполнить операцию
+	CodeAlreadyExists        = "already_exists"         // Такой ресурс уже есть
+	CodeBookUnavailable      = "book_unavailable"       // Книга уже выдана или уже возвращена
+	CodeBookOnLoan           = "book_on_loan"           // Книга выдана читателю
+	CodeBooksOnLoan          = "books_on_loan"          // У пользователя есть невозвращенные книги
+	CodeBookOnHold           = "book_on_hold"           // Книгу ждут по брони другие читатели
+	CodeHoldExists           = "hold_exists"            // Читатель уже стоит в очереди на книгу
+	CodeRenewalLimit         = "renewal_limit"          // Выдача уже продлена максимальное число раз
+	CodeUnpaidFines          = "unpaid_fines"           // У пользователя есть неоплаченные штрафы
+	CodeEmailAlreadyVerified = "email_already_verified" // Адрес уже подтвержден
+	CodeMFAAlreadyEnabled    = "mfa_already_enabled"    // Второй фактор уже подключен
+	CodePatchTestFailed      = "patch_test_failed"      // Операция test JSON Patch не выполнена
+	CodeBatchAborted         = "batch_aborted"          // Операция пакета отменена, потому что другая завершилась ошибкой
+	CodeIdempotencyKeyInUse  = "idempotency_key_in_use" // Запрос с этим Idempotency-Key еще выполняется
+	CodeIdempotencyKeyReused = "idempotency_key_reused" // Idempotency-Key уже использован для другого запроса
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotAcceptable        = "not_acceptable" // Ни один формат ответа не подходит под Accept
+	CodeBodyTooLarge         = "body_too_large"
+	CodeTooManyRequests      = "too_many_requests" // Слишком много попыток, см. Retry-After
+	CodeInternal             = "internal_error"
+)
+
+// FieldError описывает одно неверное поле запроса
+type FieldError struct {
+	Field   string `json:"field"`   // Имя поля в JSON
+	Code    string `json:"code"`    // Например required, too_long, invalid
+	Message string `json:"message"` // Описание для человека
+}
+
+// Problem — тело ответа с ошибкой. Type всегда about:blank, поэтому Title совпадает с текстом
+// HTTP статуса, а вид ошибки определяется полем Code.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"` // Путь запроса
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// New создает ошибку с HTTP статусом, кодом и описанием
+func New(status int, code, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(code, detail string) *Problem   { return New(http.StatusBadRequest, code, detail) }
+func Unauthorized(code, detail string) *Problem { return New(http.StatusUnauthorized, code, detail) }
+func Forbidden(code, detail string) *Problem    { return New(http.StatusForbidden, code, detail) }
+func NotFound(code, detail string) *Problem     { return New(http.StatusNotFound, code, detail) }
+func Conflict(code, detail string) *Problem     { return New(http.StatusConflict, code, detail) }
+
+// Validation создает ошибку 422 со списком полей, значения которых не прошли проверку
+func Validation(fields ...FieldError) *Problem {
+	p := New(http.StatusUnprocessableEntity, CodeValidation, "request has invalid fields")
+	if len(fields) == 1 {
+		p.Detail = fields[0].Message
+	}
+	p.Errors = fields
+	return p
+}
+
+// Field описывает неверное поле; используется вместе с Validation
+func Field(field, code, message string) FieldError {
+	return FieldError{Field: field, Code: code, Message: message}
+}
+
+// Write отвечает ошибкой. *Problem (в том числе обернутый) отдается как есть, любая другая ошибка
+// записывается в лог и превращается в 500 без подробностей, чтобы не раскрывать внутреннее устройство.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if errors.As(err, &p) {
+		Render(w, r, p)
+		return
+	}
+	Internal(w, r, err)
+}
+
+// Error — замена http.Error: отвечает ошибкой с заданными статусом, кодом и описанием
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Render(w, r, New(status, code, detail))
+}
+
+// Internal записывает причину в лог и отвечает 500. Если клиент отменил запрос, ответ не пишется.
+func Internal(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	log.Printf("Internal error on %s: %v", requestLine(r), err)
+	Render(w, r, InternalError())
+}
+
+// InternalError — ответ на непредвиденную ошибку сервера
+func InternalError() *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// Render пишет ответ, дополняя его путем и идентификатором запроса
+func Render(w http.ResponseWriter, r *http.Request, p *Problem) {
+	body := *p
+	if r != nil {
+		body.Instance = r.URL.Path
+		body.RequestID = middleware.GetReqID(r.Context())
+	}
+	if body.RequestID == "" {
+		body.RequestID = w.Header().Get(RequestIDHeader)
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(body.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func requestLine(r *http.Request) string {
+	if r == nil {
+		return "request"
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+// RequestID присваивает запросу идентификатор (или берет X-Request-Id от прокси)
+// и возвращает его клиенту в заголовке ответа
+func RequestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// NotFoundHandler и MethodNotAllowedHandler заменяют текстовые ответы chi для неизвестных маршрутов
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+}
+
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed for "+r.URL.Path)
+}
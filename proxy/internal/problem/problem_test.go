@@ -0,0 +1,54 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(handler http.HandlerFunc) (*httptest.ResponseRecorder, Problem) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/book", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	RequestID(handler).ServeHTTP(rec, req)
+
+	var body Problem
+	json.NewDecoder(rec.Body).Decode(&body)
+	return rec, body
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec, body := serve(func(w http.ResponseWriter, r *http.Request) {
+		err := Validation(Field("book", "required", "book title is required"), Field("author", "too_long", "author is too long"))
+		Write(w, r, fmt.Errorf("adding book: %w", err))
+	})
+
+	if rec.Code != http.StatusUnprocessableEntity || rec.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get(RequestIDHeader) != "req-42" || body.RequestID != "req-42" {
+		t.Errorf("Expected request id from the proxy, got header %q, body %q", rec.Header().Get(RequestIDHeader), body.RequestID)
+	}
+	if body.Code != CodeValidation || body.Status != http.StatusUnprocessableEntity || body.Instance != "/api/book" || body.Type != "about:blank" {
+		t.Errorf("Unexpected problem %+v", body)
+	}
+	if len(body.Errors) != 2 || body.Errors[1].Field != "author" || body.Errors[1].Code != "too_long" {
+		t.Errorf("Unexpected field errors %+v", body.Errors)
+	}
+}
+
+func TestWriteInternalError(t *testing.T) {
+	rec, body := serve(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, errors.New("pq: relation \"book\" does not exist"))
+	})
+
+	if rec.Code != http.StatusInternalServerError || body.Code != CodeInternal {
+		t.Fatalf("Expected internal error, got %d %+v", rec.Code, body)
+	}
+	if body.Detail != "Internal server error" {
+		t.Errorf("Internal details must not reach the client, got %q", body.Detail)
+	}
+}
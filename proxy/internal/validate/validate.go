@@ -0,0 +1,317 @@
+// Package validate разбирает JSON тела запросов и проверяет их по тегам validate.
+//
+// Правила перечисляются через запятую: `validate:"required,max=50,email"`.
+// Все правила, кроме required, пропускают пустые значения, поэтому необязательные поля
+// проверяются только если переданы.
+//
+//	required    — строка не пустая после обрезки пробелов, указатель и срез не nil и не пустые
+//	min=N/max=N — длина строки в символах, длина среза или значение числа
+//	oneof=a b c — значение из перечня
+//	email       — адрес вида user@example.com без отображаемого имени
+//	username    — 3-50 латинских букв, цифр, точек, дефисов или подчеркиваний
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	netmail "net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+// MaxBodyBytes ограничивает размер тела запроса по умолчанию
+const MaxBodyBytes = 1 << 20
+
+// UsernamePattern — допустимый логин для правила username
+var UsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,50}$`)
+
+// DecodeJSON читает тело запроса в dst (указатель на структуру) и проверяет его.
+// Возвращает *problem.Problem: 413 для слишком большого тела; 400 для неразборчивого JSON,
+// лишних данных после документа, неизвестных полей и полей неверного типа; 422 для значений,
+// не прошедших правила validate. В ошибках перечисляются все неверные поля сразу.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return DecodeJSONLimit(w, r, dst, MaxBodyBytes)
+}
+
+// DecodeJSONLimit — DecodeJSON с собственным ограничением размера тела
+func DecodeJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) error {
+	if err := decode(w, r, dst, limit); err != nil {
+		return err
+	}
+	return Struct(dst)
+}
+
+// Decode разбирает тело как DecodeJSON, но правила validate не проверяет: их нарушения
+// вызывающий получает через Fields и дополняет собственными проверками
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return decode(w, r, dst, MaxBodyBytes)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return problem.New(http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge,
+			fmt.Sprintf("request body must be at most %d bytes", limit))
+	}
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidRequest, "could not read request body")
+	}
+	return Unmarshal(body, dst)
+}
+
+// LimitBody ограничивает тело всех запросов, в том числе тех, что разбираются без DecodeJSON
+func LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Unmarshal разбирает ровно один JSON объект в dst, не допуская неизвестных полей.
+// Ошибки типов собираются по всем полям, а не только по первому.
+func Unmarshal(body []byte, dst interface{}) error {
+	var raw json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&raw); err != nil {
+		return syntaxProblem(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return problem.BadRequest(problem.CodeInvalidRequest, "request body must contain a single JSON document")
+	}
+
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		// Не структуры проверять по полям нечем
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return syntaxProblem(err)
+		}
+		return nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return problem.BadRequest(problem.CodeInvalidRequest, "request body must be a JSON object")
+	}
+
+	fields := jsonFields(target.Elem())
+	var invalid []problem.FieldError
+	for name, value := range object {
+		field, ok := fields[name]
+		if !ok {
+			invalid = append(invalid, problem.Field(name, "unknown", "unknown field"))
+			continue
+		}
+		if err := json.Unmarshal(value, field.Addr().Interface()); err != nil {
+			invalid = append(invalid, problem.Field(name, "type", "must be "+typeName(field.Type())))
+		}
+	}
+	if len(invalid) > 0 {
+		// Порядок обхода map случаен, а ответ должен быть одинаковым
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		p := problem.BadRequest(problem.CodeInvalidRequest, "request body has unknown or mistyped fields")
+		p.Errors = invalid
+		return p
+	}
+	return nil
+}
+
+func syntaxProblem(err error) error {
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		return problem.BadRequest(problem.CodeInvalidRequest, fmt.Sprintf("malformed JSON at offset %d", syntax.Offset))
+	}
+	if errors.Is(err, io.EOF) {
+		return problem.BadRequest(problem.CodeInvalidRequest, "request body is empty")
+	}
+	return problem.BadRequest(problem.CodeInvalidRequest, "malformed JSON")
+}
+
+// Struct проверяет правила validate у полей структуры и возвращает 422 со всеми нарушениями или nil
+func Struct(v interface{}) error {
+	if fields := Fields(v); len(fields) > 0 {
+		return problem.Validation(fields...)
+	}
+	return nil
+}
+
+// Fields возвращает нарушения правил validate; удобно, когда к ним нужно добавить собственные проверки
+func Fields(v interface{}) []problem.FieldError {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var invalid []problem.FieldError
+	collect(value, &invalid)
+	return invalid
+}
+
+func collect(value reflect.Value, invalid *[]problem.FieldError) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collect(value.Field(i), invalid)
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := jsonName(field)
+		for _, rule := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(rule, "=")
+			if code, message := check(value.Field(i), ruleName, param); code != "" {
+				*invalid = append(*invalid, problem.Field(name, code, name+" "+message))
+				break // Об одном поле достаточно одной ошибки
+			}
+		}
+	}
+}
+
+// check возвращает код и текст нарушения или пустой код, если правило выполнено
+func check(value reflect.Value, rule, param string) (code, message string) {
+	if rule == "required" {
+		if isEmpty(value) {
+			return "required", "is required"
+		}
+		return "", ""
+	}
+	if isEmpty(value) {
+		return "", ""
+	}
+	value = reflect.Indirect(value)
+
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			panic("validate: invalid " + rule + " parameter " + param)
+		}
+		size, unit := measure(value)
+		if rule == "min" && size < limit {
+			return "too_short", fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if rule == "max" && size > limit {
+			return "too_long", fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return "", ""
+			}
+		}
+		return "invalid", "must be one of " + strings.Join(options, ", ")
+	case "email":
+		address, err := netmail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return "invalid", "must be a valid email address"
+		}
+	case "username":
+		if !UsernamePattern.MatchString(value.String()) {
+			return "invalid", "must be 3-50 characters: letters, digits, dots, dashes or underscores"
+		}
+	default:
+		panic("validate: unknown rule " + rule)
+	}
+	return "", ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func measure(value reflect.Value) (int, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len(), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return int(value.Float()), ""
+	}
+	panic("validate: min/max on unsupported kind " + value.Kind().String())
+}
+
+// jsonFields сопоставляет имена JSON полей структуры (с учетом встроенных структур) с самими полями
+func jsonFields(value reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			for name, inner := range jsonFields(value.Field(i)) {
+				fields[name] = inner
+			}
+			continue
+		}
+		fields[jsonName(field)] = value.Field(i)
+	}
+	return fields
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct:
+		if t.PkgPath() == "time" && t.Name() == "Time" {
+			return "an RFC 3339 timestamp"
+		}
+		return "an object"
+	case reflect.Map:
+		return "an object"
+	}
+	return "a valid value"
+}
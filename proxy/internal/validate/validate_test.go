@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+)
+
+type bookRequest struct {
+	Title  string   `json:"title" validate:"required,max=5"`
+	Author string   `json:"author" validate:"required"`
+	Email  string   `json:"email" validate:"email"`
+	Kind   string   `json:"kind" validate:"oneof=paper ebook"`
+	Pages  int      `json:"pages" validate:"min=1"`
+	Tags   []string `json:"tags" validate:"max=2"`
+}
+
+func decodeBody(t *testing.T, body string) *problem.Problem {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	var dst bookRequest
+	err := DecodeJSONLimit(httptest.NewRecorder(), req, &dst, 256)
+	if err == nil {
+		return nil
+	}
+	var p *problem.Problem
+	if !errors.As(err, &p) {
+		t.Fatalf("Expected problem, got %v", err)
+	}
+	return p
+}
+
+func codes(p *problem.Problem) map[string]string {
+	result := make(map[string]string)
+	for _, field := range p.Errors {
+		result[field.Field] = field.Code
+	}
+	return result
+}
+
+func TestDecodeJSON(t *testing.T) {
+	if p := decodeBody(t, `{"title":"Go","author":"Pike","kind":"ebook","pages":3}`); p != nil {
+		t.Fatalf("Expected valid body, got %+v", p)
+	}
+
+	cases := []struct {
+		name, body string
+		status     int
+	}{
+		{"empty", ``, http.StatusBadRequest},
+		{"malformed", `{"title":`, http.StatusBadRequest},
+		{"trailing garbage", `{"title":"Go","author":"Pike"} {}`, http.StatusBadRequest},
+		{"not an object", `["Go"]`, http.StatusBadRequest},
+		{"too large", `{"title":"` + strings.Repeat("a", 300) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		if p := decodeBody(t, c.body); p == nil || p.Status != c.status {
+			t.Errorf("%s: expected %d, got %+v", c.name, c.status, p)
+		}
+	}
+}
+
+func TestDecodeJSONListsEveryField(t *testing.T) {
+	p := decodeBody(t, `{"title":1,"pages":"many","isbn":"123"}`)
+	if p == nil || p.Status != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %+v", p)
+	}
+	want := map[string]string{"title": "type", "pages": "type", "isbn": "unknown"}
+	if got := codes(p); len(got) != len(want) || got["title"] != "type" || got["pages"] != "type" || got["isbn"] != "unknown" {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	p = decodeBody(t, `{"title":"Too long","author":"  ","email":"Pike <rob@example.com>","kind":"scroll","pages":-1,"tags":["a","b","c"]}`)
+	if p == nil || p.Status != http.StatusUnprocessableEntity || p.Code != problem.CodeValidation {
+		t.Fatalf("Expected 422, got %+v", p)
+	}
+	want = map[string]string{"title": "too_long", "author": "required", "email": "invalid", "kind": "invalid", "pages": "too_short", "tags": "too_long"}
+	got := codes(p)
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("%s: expected %s, got %q", field, code, got[field])
+		}
+	}
+}
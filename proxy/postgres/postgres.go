@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/brianvoe/gofakeit"
 	"studentgit.kata.academy/Zhodaran/go-kata/config"
@@ -12,10 +14,133 @@ func RunMigrations(db *sql.DB) {
 	migrationSQL := `
 	CREATE TABLE IF NOT EXISTS users (
 		id SERIAL PRIMARY KEY,
+		username VARCHAR(50) NOT NULL UNIQUE,
+		password VARCHAR(255) NOT NULL DEFAULT '', -- хеш пароля в формате PHC
 		name VARCHAR(50) NOT NULL,
 		email VARCHAR(255) NOT NULL,
+		role VARCHAR(20) NOT NULL DEFAULT 'patron',
 		deleted_at TIMESTAMP NULL
-	);`
+	);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS username VARCHAR(50) UNIQUE;
+	UPDATE users SET username = 'user_' || id WHERE username IS NULL; -- пользователи, созданные до появления логинов
+	ALTER TABLE users ALTER COLUMN username SET NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS password VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'patron';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE TABLE IF NOT EXISTS loans (
+		id SERIAL PRIMARY KEY,
+		user_id INT REFERENCES users(id) ON DELETE SET NULL,
+		book_index INT NOT NULL,
+		taken_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		returned_at TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS holds (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		book_index INT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		closed_at TIMESTAMP NULL -- бронь выполнена или отменена
+	);
+	ALTER TABLE loans ADD COLUMN IF NOT EXISTS due_at TIMESTAMP NULL; -- NULL — срок не продлевался, см. LOAN_PERIOD
+	ALTER TABLE loans ADD COLUMN IF NOT EXISTS renewals INT NOT NULL DEFAULT 0;
+	CREATE INDEX IF NOT EXISTS loans_open_book_idx ON loans (book_index) WHERE returned_at IS NULL;
+	CREATE INDEX IF NOT EXISTS holds_open_book_idx ON holds (book_index, created_at) WHERE closed_at IS NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS holds_open_user_book_idx ON holds (user_id, book_index) WHERE closed_at IS NULL;
+	CREATE TABLE IF NOT EXISTS fines (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		amount NUMERIC(10, 2) NOT NULL,
+		reason VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		paid_at TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_agent VARCHAR(255) NOT NULL DEFAULT '',
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		revoked_at TIMESTAMP NULL
+	);
+	ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash CHAR(64) PRIMARY KEY,
+		session_id VARCHAR(64) NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		token_hash CHAR(64) PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		purpose VARCHAR(20) NOT NULL,
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(16) NOT NULL,
+		key_hash CHAR(64) NOT NULL UNIQUE,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP NULL,
+		last_used_at TIMESTAMP NULL,
+		revoked_at TIMESTAMP NULL
+	);
+	ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE TABLE IF NOT EXISTS user_identities (
+		issuer VARCHAR(255) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (issuer, subject)
+	);
+	CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret VARCHAR(64) NOT NULL,
+		confirmed_at TIMESTAMP NULL,
+		last_used_step BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash CHAR(64) NOT NULL,
+		used_at TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		attempt_key VARCHAR(320) PRIMARY KEY,
+		failures INT NOT NULL DEFAULT 0,
+		last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		locked_until TIMESTAMP NULL
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id SERIAL PRIMARY KEY,
+		event VARCHAR(50) NOT NULL,
+		actor_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+		username VARCHAR(255) NOT NULL DEFAULT '',
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		scope VARCHAR(64) NOT NULL,
+		idempotency_key VARCHAR(255) NOT NULL,
+		request_hash CHAR(64) NOT NULL,
+		status INT NOT NULL DEFAULT 0, -- 0, пока запрос выполняется
+		content_type VARCHAR(255) NOT NULL DEFAULT '',
+		location VARCHAR(255) NOT NULL DEFAULT '',
+		body BYTEA NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (scope, idempotency_key)
+	);
+	ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP NOT NULL DEFAULT NOW(); -- после него незавершенную запись может занять повтор`
 
 	_, err := db.Exec(migrationSQL)
 	if err != nil {
@@ -30,8 +155,10 @@ func CreateTableBook(db *sql.DB) []config.Book {
 		book VARCHAR(50) NOT NULL,
 		author VARCHAR(255) NOT NULL,
 		block BOOLEAN,
-		take_count INT DEFAULT 0
-	);`
+		take_count INT DEFAULT 0,
+		deleted_at TIMESTAMP NULL
+	);
+	ALTER TABLE book ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;`
 
 	var authors []string
 	for i := 0; i < 10; i++ {
@@ -66,3 +193,62 @@ func CreateTableBook(db *sql.DB) []config.Book {
 	return books
 
 }
+
+// PurgeDeletedBooks окончательно удаляет книги, пролежавшие в корзине дольше retention
+func PurgeDeletedBooks(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM book WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - $1 * INTERVAL '1 second'",
+		retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartBookPurger периодически очищает корзину книг, пока не отменен ctx
+func StartBookPurger(ctx context.Context, db *sql.DB, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeDeletedBooks(ctx, db, retention)
+		if err != nil {
+			log.Printf("Error purging deleted books: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted books", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpiredIdempotencyKeys удаляет сохраненные ответы с истекшим сроком
+func PurgeExpiredIdempotencyKeys(ctx context.Context, db *sql.DB) (int64, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartIdempotencyPurger периодически удаляет истекшие ключи идемпотентности, пока не отменен ctx
+func StartIdempotencyPurger(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := PurgeExpiredIdempotencyKeys(ctx, db); err != nil {
+			log.Printf("Error purging idempotency keys: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
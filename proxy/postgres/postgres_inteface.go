@@ -2,23 +2,136 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
 )
 
-type ErrorResponse struct {
-	Message string `json:"message"` // Сообщение об ошибке
-	Code    int    `json:"code"`    // Код ошибки
-}
-
 type UserController struct {
 	userRepo UserRepository
 }
 
 type UserRepository interface {
-	Create(ctx context.Context, user models.User) error
+	Create(ctx context.Context, user models.User) (int, error)
 	GetByID(ctx context.Context, id string) (models.User, error)
+	GetByUsername(ctx context.Context, username string) (models.User, error)
+	GetByIDWithDeleted(ctx context.Context, id string) (models.User, error)
 	Update(ctx context.Context, user models.User) error
+	UpdatePasswordHash(ctx context.Context, id int, hash string) error
+	MarkEmailVerified(ctx context.Context, id int, email string) error
+	ListByEmail(ctx context.Context, email string) ([]models.User, error)
+	// Delete помечает пользователя удаленным; при книгах на руках или неоплаченных штрафах
+	// возвращает ErrUserHasOpenLoans или ErrUserHasUnpaidFines
 	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	Purge(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int) ([]models.User, error)
 }
+
+var (
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrUserHasOpenLoans    = errors.New("user has books on loan")
+	ErrUserHasUnpaidFines  = errors.New("user has unpaid fines")
+)
+
+// SessionRepository хранит сессии пользователей и принадлежащие им токены обновления
+type SessionRepository interface {
+	Create(ctx context.Context, session models.Session, refreshHash string, expiresAt time.Time) error
+	// Rotate помечает токен обновления использованным и выдает вместо него новый.
+	// Повторное использование токена отзывает всю сессию и возвращает ее вместе с ErrRefreshTokenReused.
+	Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (models.Session, error)
+	Revoke(ctx context.Context, sessionID string) error
+	RevokeAllForUser(ctx context.Context, userID int) ([]string, error)
+	// ListActiveForUser возвращает незакрытые сессии пользователя, у которых есть действующий токен обновления
+	ListActiveForUser(ctx context.Context, userID int) ([]models.Session, error)
+	// RevokeForUser закрывает сессию, только если она принадлежит пользователю
+	RevokeForUser(ctx context.Context, userID int, sessionID string) error
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// LoginAttemptRepository хранит счетчики неудачных входов по ключу ("user:<логин>" или "ip:<адрес>"),
+// чтобы блокировки переживали перезапуск сервиса
+type LoginAttemptRepository interface {
+	// RecordFailure увеличивает счетчик и возвращает его; счетчик без неудач дольше window начинается заново
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil возвращает время окончания блокировки или нулевое время, если ее нет
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// AuditRepository сохраняет записи журнала событий безопасности
+type AuditRepository interface {
+	Record(ctx context.Context, entry models.AuditEntry) error
+}
+
+// UserTokenRepository хранит одноразовые токены подтверждения адреса и сброса пароля
+type UserTokenRepository interface {
+	Create(ctx context.Context, token models.UserToken) error
+	// Find возвращает действующий токен, не помечая его использованным
+	Find(ctx context.Context, tokenHash, purpose string) (models.UserToken, error)
+	// Consume помечает токен использованным и возвращает его;
+	// использованный, просроченный или неизвестный токен дает sql.ErrNoRows
+	Consume(ctx context.Context, tokenHash, purpose string) (models.UserToken, error)
+	// InvalidateForUser гасит все неиспользованные токены пользователя с этим назначением
+	InvalidateForUser(ctx context.Context, userID int, purpose string) error
+}
+
+// APIKeyRepository хранит API ключи пользователей; сам ключ не хранится, только его хеш
+type APIKeyRepository interface {
+	Create(ctx context.Context, key models.APIKey, keyHash string) (models.APIKey, error)
+	// GetActiveByHash возвращает неотозванный и непросроченный ключ
+	GetActiveByHash(ctx context.Context, keyHash string) (models.APIKey, error)
+	ListForUser(ctx context.Context, userID int) ([]models.APIKey, error)
+	// Revoke отзывает ключ пользователя; чужой или уже отозванный ключ дает sql.ErrNoRows
+	Revoke(ctx context.Context, userID, id int) error
+	TouchLastUsed(ctx context.Context, id int, at time.Time) error
+	// ClearMFA снимает отметку второго фактора со всех ключей пользователя
+	ClearMFA(ctx context.Context, userID int) error
+}
+
+// ExternalIdentityRepository связывает учетные записи внешнего провайдера (issuer + subject) с локальными пользователями
+type ExternalIdentityRepository interface {
+	GetUserID(ctx context.Context, issuer, subject string) (int, error)
+	Link(ctx context.Context, issuer, subject string, userID int) error
+}
+
+// MFARepository хранит TOTP секреты и одноразовые коды восстановления
+type MFARepository interface {
+	// Get возвращает настройки MFA пользователя или sql.ErrNoRows, если их нет
+	Get(ctx context.Context, userID int) (models.MFA, error)
+	// SaveSecret начинает подключение заново: сохраняет неподтвержденный секрет
+	SaveSecret(ctx context.Context, userID int, secret string) error
+	Confirm(ctx context.Context, userID int, step int64) error
+	Disable(ctx context.Context, userID int) error
+	// UseStep запоминает шаг принятого кода; шаг не новее последнего дает sql.ErrNoRows
+	UseStep(ctx context.Context, userID int, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error
+	// UseRecoveryCode гасит код восстановления; неизвестный или использованный код дает sql.ErrNoRows
+	UseRecoveryCode(ctx context.Context, userID int, hash string) error
+}
+
+// IdempotencyRepository хранит ответы на запросы с заголовком Idempotency-Key до истечения срока
+type IdempotencyRepository interface {
+	// Reserve занимает ключ под новый запрос и возвращает true. Если ключ уже занят и не истек,
+	// возвращает сохраненную запись и false.
+	Reserve(ctx context.Context, record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error)
+	// Complete сохраняет ответ на запрос, занявший ключ
+	Complete(ctx context.Context, record models.IdempotencyRecord) error
+	// Release освобождает ключ, чтобы запрос можно было повторить, например после ошибки сервера
+	Release(ctx context.Context, scope, key string) error
+}
+
+// LoanRepository читает выдачи и брони сразу для набора книг или читателей, чтобы связи
+// встраивались в ответ одним запросом на связь, а не запросом на каждую запись
+type LoanRepository interface {
+	// OpenLoansByBooks возвращает невозвращенные выдачи книг, по одной на книгу
+	OpenLoansByBooks(ctx context.Context, indexes []int) ([]models.Loan, error)
+	OpenLoansByUsers(ctx context.Context, userIDs []int) ([]models.Loan, error)
+	// HoldsByBooks возвращает действующие брони в порядке очереди
+	HoldsByBooks(ctx context.Context, indexes []int) ([]models.Hold, error)
+	HoldsByUsers(ctx context.Context, userIDs []int) ([]models.Hold, error)
+}
@@ -0,0 +1,274 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/apidoc"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/db/adapter"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/middle"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/models"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/negotiate"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/patch"
+)
+
+// Описания маршрутов для OpenAPI документа. Request и Response — те же типы, что читают и пишут обработчики.
+// Новый маршрут нужно описать здесь, иначе TestOpenAPICoversEveryRoute не пройдет.
+
+const apiTitle = "Library API"
+
+// Параметры пути, которые обработчики разбирают как числа
+var pathParamTypes = map[string]string{"id": "integer", "index": "integer", "keyID": "integer"}
+
+const (
+	badRequest   = http.StatusBadRequest
+	forbidden    = http.StatusForbidden
+	notFound     = http.StatusNotFound
+	conflict     = http.StatusConflict
+	tooLarge     = http.StatusRequestEntityTooLarge
+	unsupported  = http.StatusUnsupportedMediaType
+	unprocessed  = http.StatusUnprocessableEntity
+	tooMany      = http.StatusTooManyRequests
+	notAccepted  = http.StatusNotAcceptable
+	serverFailed = http.StatusInternalServerError
+)
+
+// idempotent добавляет к описанию заголовок Idempotency-Key и ответы на повтор ключа: 409, пока первый
+// запрос выполняется, и 422 для другого запроса с тем же ключом
+func idempotent(route apidoc.Route) apidoc.Route {
+	route.Headers = append(route.Headers, apidoc.Param{Name: middle.IdempotencyKeyHeader, Type: "string",
+		Description: "Repeats with the same key replay the first response"})
+	codes := append([]int{}, route.Errors...)
+	for _, code := range []int{conflict, unprocessed} {
+		found := false
+		for _, existing := range codes {
+			found = found || existing == code
+		}
+		if !found {
+			codes = append(codes, code)
+		}
+	}
+	route.Errors = codes
+	return route
+}
+
+// negotiated описывает ответ, который отдается в JSON, CSV, XML или MessagePack по заголовку Accept
+func negotiated(route apidoc.Route) apidoc.Route {
+	route.Produces = negotiate.Offered()
+	route.Errors = append(append([]int{}, route.Errors...), notAccepted)
+	return route
+}
+
+// sparse описывает ответ, поля которого выбираются через fields=, а связи встраиваются через include=
+func sparse(route apidoc.Route, relations ...string) apidoc.Route {
+	route.Sparse = true
+	route.Query = append(append([]apidoc.Param{}, route.Query...),
+		apidoc.Param{Name: "fields", Type: "string", Description: "Comma-separated fields to return, all by default"},
+		apidoc.Param{Name: "include", Type: "string", Description: "Comma-separated relations to embed: " + strings.Join(relations, ", ")},
+	)
+	return route
+}
+
+// rootRoutes — маршруты вне версий API
+func rootRoutes() []apidoc.Route {
+	return []apidoc.Route{
+		{Method: "GET", Path: "/.well-known/jwks.json", Summary: "JSON Web Key Set for access token verification", Tag: "auth",
+			Response: map[string]interface{}{}},
+		{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document of all API versions", Tag: "docs",
+			Response: map[string]interface{}{}},
+	}
+}
+
+// sharedRoutes — вход, учетная запись и пользователи; одинаковы в v1 и v2
+func sharedRoutes() []apidoc.Route {
+	return []apidoc.Route{
+		{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document of this version", Tag: "docs",
+			Response: map[string]interface{}{}},
+
+		{Method: "POST", Path: "/register", Summary: "Register a new user", Tag: "auth",
+			Request: service.RegisterRequest{}, Status: http.StatusCreated, Response: models.User{},
+			Errors: []int{badRequest, conflict, tooLarge, unprocessed, serverFailed}},
+		{Method: "POST", Path: "/login", Summary: "Login with username and password", Tag: "auth",
+			Request: service.User{}, Response: apidoc.OneOf(service.TokenResponse{}, service.MFAChallengeResponse{}),
+			Errors: []int{badRequest, http.StatusUnauthorized, forbidden, unprocessed, tooMany, serverFailed}},
+		{Method: "POST", Path: "/login/mfa", Summary: "Complete login with a second factor", Tag: "auth",
+			Request: service.MFALoginRequest{}, Response: service.TokenResponse{},
+			Errors: []int{badRequest, http.StatusUnauthorized, tooMany, serverFailed}},
+		{Method: "POST", Path: "/token/refresh", Summary: "Refresh access token", Tag: "auth",
+			Request: service.RefreshRequest{}, Response: service.TokenResponse{},
+			Errors: []int{badRequest, http.StatusUnauthorized, serverFailed}},
+		{Method: "POST", Path: "/email/verify", Summary: "Verify email address", Tag: "auth",
+			Request: service.VerifyEmailRequest{}, Status: http.StatusNoContent, Errors: []int{badRequest, serverFailed}},
+		{Method: "POST", Path: "/password/forgot", Summary: "Request password reset", Tag: "auth",
+			Request: service.ForgotPasswordRequest{}, Status: http.StatusAccepted, Errors: []int{badRequest}},
+		{Method: "POST", Path: "/password/reset", Summary: "Reset password", Tag: "auth",
+			Request: service.ResetPasswordRequest{}, Status: http.StatusNoContent, Errors: []int{badRequest, serverFailed}},
+		// Вход через OIDC регистрируется только при заданном OIDC_ISSUER, но описан всегда
+		{Method: "GET", Path: "/oidc/login", Summary: "Start single sign-on", Tag: "auth",
+			Status: http.StatusFound, Errors: []int{serverFailed}},
+		{Method: "GET", Path: "/oidc/callback", Summary: "Finish single sign-on", Tag: "auth",
+			Query: []apidoc.Param{
+				{Name: "code", Type: "string", Description: "Authorization code", Required: true},
+				{Name: "state", Type: "string", Description: "State from /oidc/login", Required: true},
+			},
+			Response: service.TokenResponse{}, Errors: []int{badRequest, http.StatusUnauthorized, forbidden, serverFailed}},
+
+		{Method: "POST", Path: "/logout", Summary: "Logout", Tag: "auth", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{serverFailed}},
+		{Method: "POST", Path: "/logout/all", Summary: "Logout from all sessions", Tag: "auth", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{serverFailed}},
+		{Method: "POST", Path: "/email/verify/resend", Summary: "Resend verification email", Tag: "auth", Auth: true,
+			Status: http.StatusAccepted, Errors: []int{conflict, serverFailed}},
+		{Method: "POST", Path: "/mfa/totp", Summary: "Start TOTP enrollment", Tag: "mfa", Auth: true,
+			Response: service.MFAEnrollResponse{}, Errors: []int{forbidden, conflict, serverFailed}},
+		{Method: "POST", Path: "/mfa/totp/confirm", Summary: "Confirm TOTP enrollment", Tag: "mfa", Auth: true,
+			Request: service.MFACodeRequest{}, Response: service.RecoveryCodesResponse{},
+			Errors: []int{badRequest, notFound, conflict, serverFailed}},
+		{Method: "POST", Path: "/mfa/recovery-codes", Summary: "Regenerate recovery codes", Tag: "mfa", Auth: true,
+			Request: service.MFACodeRequest{}, Response: service.RecoveryCodesResponse{},
+			Errors: []int{badRequest, notFound, serverFailed}},
+		{Method: "DELETE", Path: "/mfa/totp", Summary: "Disable TOTP", Tag: "mfa", Auth: true,
+			Request: service.MFACodeRequest{}, Status: http.StatusNoContent, Errors: []int{badRequest, notFound, serverFailed}},
+
+		sparse(apidoc.Route{Method: "GET", Path: "/users/{id}", Summary: "Get user", Tag: "users", Auth: true,
+			Response: adapter.UserView{}, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+			adapter.IncludeLoans, adapter.IncludeHolds),
+		{Method: "PATCH", Path: "/users/{id}", Summary: "Patch user", Tag: "users", Auth: true,
+			Request:  apidoc.Content{patch.MergePatchType: map[string]interface{}{}, patch.JSONPatchType: []patch.Operation{}},
+			Response: models.User{}, Errors: []int{badRequest, forbidden, notFound, conflict, unsupported, unprocessed, serverFailed}},
+		{Method: "GET", Path: "/users/{id}/sessions", Summary: "List user sessions", Tag: "users", Auth: true,
+			Response: []service.SessionResponse{}, Errors: []int{badRequest, forbidden, serverFailed}},
+		{Method: "DELETE", Path: "/users/{id}/sessions", Summary: "Revoke all user sessions", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, serverFailed}},
+		{Method: "DELETE", Path: "/users/{id}/sessions/{sessionID}", Summary: "Revoke user session", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+		{Method: "GET", Path: "/users/{id}/api-keys", Summary: "List API keys", Tag: "users", Auth: true,
+			Response: []models.APIKey{}, Errors: []int{badRequest, forbidden, serverFailed}},
+		{Method: "POST", Path: "/users/{id}/api-keys", Summary: "Create API key", Tag: "users", Auth: true,
+			Request: service.CreateAPIKeyRequest{}, Status: http.StatusCreated, Response: service.CreateAPIKeyResponse{},
+			Errors: []int{badRequest, forbidden, notFound, unprocessed, serverFailed}},
+		{Method: "DELETE", Path: "/users/{id}/api-keys/{keyID}", Summary: "Revoke API key", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+
+		idempotent(apidoc.Route{Method: "POST", Path: "/users", Summary: "Create user", Tag: "users", Auth: true,
+			Request: models.User{}, Status: http.StatusCreated, Response: models.User{},
+			Errors: []int{badRequest, forbidden, conflict, tooLarge, unprocessed, serverFailed}}),
+		negotiated(sparse(apidoc.Route{Method: "GET", Path: "/users", Summary: "List users", Tag: "users", Auth: true,
+			Query: []apidoc.Param{
+				{Name: "limit", Type: "integer", Description: "Page size, 1-100, default 10"},
+				{Name: "offset", Type: "integer", Description: "Number of users to skip"},
+			},
+			Response: []adapter.UserView{}, Errors: []int{badRequest, forbidden, serverFailed}},
+			adapter.IncludeLoans, adapter.IncludeHolds)),
+		{Method: "PUT", Path: "/users/{id}", Summary: "Replace user", Tag: "users", Auth: true,
+			Request: models.User{}, Response: models.User{},
+			Errors: []int{badRequest, forbidden, notFound, conflict, tooLarge, unprocessed, serverFailed}},
+		{Method: "DELETE", Path: "/users/{id}", Summary: "Delete user", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, notFound, conflict, serverFailed}},
+		{Method: "GET", Path: "/admin/users/{id}", Summary: "Get user including deleted", Tag: "users", Auth: true,
+			Response: models.User{}, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+		{Method: "POST", Path: "/admin/users/{id}/restore", Summary: "Restore deleted user", Tag: "users", Auth: true,
+			Response: adapter.CreateResponse{}, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+		{Method: "DELETE", Path: "/admin/users/{id}", Summary: "Purge deleted user", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+		{Method: "POST", Path: "/admin/users/{id}/unlock", Summary: "Unlock user account", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{forbidden, notFound, serverFailed}},
+		{Method: "DELETE", Path: "/admin/users/{id}/mfa", Summary: "Reset user MFA", Tag: "users", Auth: true,
+			Status: http.StatusNoContent, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+	}
+}
+
+// bookEditRoutes — изменение, удаление и восстановление книги; пути различаются только префиксом
+func bookEditRoutes(prefix string) []apidoc.Route {
+	return []apidoc.Route{
+		{Method: "PUT", Path: prefix + "/{index}", Summary: "Replace book", Tag: "books", Auth: true,
+			Request: config.Book{}, Response: config.Book{},
+			Errors: []int{badRequest, forbidden, notFound, tooLarge, unprocessed, serverFailed}},
+		{Method: "PATCH", Path: prefix + "/{index}", Summary: "Patch book", Tag: "books", Auth: true,
+			Request:  apidoc.Content{patch.MergePatchType: map[string]interface{}{}, patch.JSONPatchType: []patch.Operation{}},
+			Response: config.Book{}, Errors: []int{badRequest, forbidden, notFound, conflict, unsupported, unprocessed, serverFailed}},
+		{Method: "DELETE", Path: prefix + "/{index}", Summary: "Move book to trash", Tag: "books", Auth: true,
+			Response: config.Book{}, Errors: []int{badRequest, forbidden, notFound, conflict, serverFailed}},
+		negotiated(apidoc.Route{Method: "GET", Path: prefix + "/trash", Summary: "List deleted books", Tag: "books", Auth: true,
+			Response: []config.Book{}, Errors: []int{forbidden, serverFailed}}),
+		{Method: "POST", Path: prefix + "/{index}/restore", Summary: "Restore book from trash", Tag: "books", Auth: true,
+			Response: config.Book{}, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+	}
+}
+
+func v1Routes() []apidoc.Route {
+	routes := append(sharedRoutes(),
+		negotiated(apidoc.Route{Method: "GET", Path: "/books", Summary: "List books", Tag: "books",
+			Response: []config.Book{}, Errors: []int{serverFailed}}),
+		negotiated(apidoc.Route{Method: "GET", Path: "/author", Summary: "List authors of books on loan", Tag: "authors",
+			Response: []string{}}),
+		negotiated(apidoc.Route{Method: "GET", Path: "/get-authors", Summary: "List authors", Tag: "authors",
+			Response: []string{}, Errors: []int{notFound}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/authors", Summary: "Add author", Tag: "authors", Auth: true,
+			Request: controller.AuthorRequest{}, Response: map[string]string{},
+			Errors: []int{badRequest, forbidden, tooLarge, unprocessed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/book/take/{index}", Summary: "Take book", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Response: map[string]string{},
+			Errors: []int{badRequest, forbidden, serverFailed}}),
+		idempotent(apidoc.Route{Method: "DELETE", Path: "/book/return/{index}", Summary: "Return book", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Response: map[string]string{},
+			Errors: []int{badRequest, forbidden, notFound, serverFailed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/book", Summary: "Add book", Tag: "books", Auth: true,
+			Request: models.AddaderBook{}, Response: config.Book{},
+			Errors: []int{badRequest, forbidden, tooLarge, unprocessed, serverFailed}}),
+	)
+	routes = append(routes, bookEditRoutes("/book")...)
+	for i := range routes {
+		routes[i].Deprecated = true
+	}
+	return routes
+}
+
+func v2Routes() []apidoc.Route {
+	routes := append(sharedRoutes(),
+		negotiated(sparse(apidoc.Route{Method: "GET", Path: "/books", Summary: "List books", Tag: "books", OptionalAuth: true,
+			Response: []controller.BookView{}, Errors: []int{badRequest, forbidden, serverFailed}},
+			controller.IncludeAuthors, controller.IncludeCurrentLoan, controller.IncludeHolds)),
+		negotiated(sparse(apidoc.Route{Method: "GET", Path: "/books/{index}", Summary: "Get book", Tag: "books", OptionalAuth: true,
+			Response: controller.BookView{}, Errors: []int{badRequest, forbidden, notFound, serverFailed}},
+			controller.IncludeAuthors, controller.IncludeCurrentLoan, controller.IncludeHolds)),
+		idempotent(apidoc.Route{Method: "POST", Path: "/books", Summary: "Add book", Tag: "books", Auth: true,
+			Request: models.AddaderBook{}, Status: http.StatusCreated, Response: config.Book{},
+			Errors: []int{badRequest, forbidden, tooLarge, unprocessed, serverFailed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/books/batch", Summary: "Run batch of book operations", Tag: "books", Auth: true,
+			Request: controller.BatchRequest{}, Response: controller.BatchResponse{},
+			Errors: []int{badRequest, forbidden, tooLarge, unprocessed, serverFailed}}),
+		negotiated(apidoc.Route{Method: "GET", Path: "/authors", Summary: "List authors", Tag: "authors",
+			Response: []string{}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/authors", Summary: "Add author", Tag: "authors", Auth: true,
+			Request: controller.AuthorRequest{}, Status: http.StatusCreated, Response: controller.AuthorRequest{},
+			Errors: []int{badRequest, forbidden, tooLarge, unprocessed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/books/{index}/loan", Summary: "Take book", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Status: http.StatusCreated, Response: config.Book{},
+			Errors: []int{badRequest, forbidden, serverFailed}}),
+		idempotent(apidoc.Route{Method: "DELETE", Path: "/books/{index}/loan", Summary: "Return book", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Status: http.StatusNoContent,
+			Errors: []int{badRequest, forbidden, notFound, serverFailed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/books/{index}/loan/renew", Summary: "Renew loan", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Response: controller.LoanRenewal{},
+			Errors: []int{badRequest, forbidden, notFound, conflict, serverFailed}}),
+		idempotent(apidoc.Route{Method: "POST", Path: "/books/{index}/hold", Summary: "Place hold", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Status: http.StatusCreated, Response: models.Hold{},
+			Errors: []int{badRequest, forbidden, notFound, conflict, serverFailed}}),
+		idempotent(apidoc.Route{Method: "DELETE", Path: "/books/{index}/hold", Summary: "Cancel hold", Tag: "loans", Auth: true,
+			Request: controller.TakeBookRequest{}, OptionalBody: true, Status: http.StatusNoContent,
+			Errors: []int{badRequest, forbidden, notFound, serverFailed}}),
+	)
+	return append(routes, bookEditRoutes("/books")...)
+}
+
+// allRoutes описывает все маршруты корневого роутера полными путями
+func allRoutes() []apidoc.Route {
+	routes := rootRoutes()
+	routes = append(routes, apidoc.Prefix("/api/v2", v2Routes())...)
+	routes = append(routes, apidoc.Prefix("/api/v1", v1Routes())...)
+	return append(routes, apidoc.Prefix("/api", v1Routes())...)
+}
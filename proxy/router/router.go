@@ -1,19 +1,53 @@
 package router
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	httpSwagger "github.com/swaggo/http-swagger"
 	"studentgit.kata.academy/Zhodaran/go-kata/config"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/apidoc"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/db/adapter"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/middle"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/oidc"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/mail"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/problem"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/validate"
 	"studentgit.kata.academy/Zhodaran/go-kata/proxy/postgres"
 )
 
+// api хранит зависимости обработчиков, общие для всех версий API
+type api struct {
+	resp           controller.Responder
+	db             *sql.DB
+	books          *[]config.Book
+	library        *controller.Library
+	userRepo       *adapter.PostgresUserRepository
+	loans          *adapter.PostgresLoanRepository
+	bookController *config.BookController
+	userController *adapter.UserController
+	sessions       *service.SessionManager
+	accounts       *service.AccountFlows
+	apiKeys        *service.APIKeyManager
+	oidcLogin      *service.OIDCLogin
+	loginGuard     *service.LoginGuard
+	mfaManager     *service.MFAManager
+	mfaPolicy      service.MFAPolicy
+	idempotency    middle.IdempotencyStore
+	idempotencyTTL time.Duration
+	requestTimeout time.Duration // Срок выполнения запроса с Idempotency-Key, см. config.IdempotentRequestTimeout
+	loanRules      config.LoanConfig
+	trustedProxies []*net.IPNet // Прокси, которым можно верить в X-Forwarded-For, см. config.TrustedProxies
+}
+
 func Router(resp controller.Responder, db *sql.DB) http.Handler {
 
 	postgres.RunMigrations(db)
@@ -22,36 +56,209 @@ func Router(resp controller.Responder, db *sql.DB) http.Handler {
 
 	library.AddBooks(books)
 	userRepo := adapter.NewPostgresUserRepository(db)
-	bookController := &config.BookController{DB: db}
+	loans := adapter.NewPostgresLoanRepository(db)
+	sessions := service.NewSessionManager(adapter.NewPostgresSessionRepository(db), config.AccessTokenTTL(), config.RefreshTokenTTL())
+	mailConfig := config.MailSettings()
+	loginGuard := service.NewLoginGuard(adapter.NewPostgresLoginAttemptRepository(db), adapter.NewPostgresAuditRepository(db), config.LoginThrottleSettings())
+	mfaConfig := config.MFASettings()
+	apiKeyRepo := adapter.NewPostgresAPIKeyRepository(db)
+	oidcLogin, err := newOIDCLogin(db, userRepo, sessions)
+	if err != nil {
+		log.Fatalf("Error configuring OIDC login: %v", err)
+	}
+	trustedProxies, err := config.TrustedProxies()
+	if err != nil {
+		log.Fatalf("Error configuring trusted proxies: %v", err)
+	}
 
-	userController := adapter.UserController{userRepo}
+	a := &api{
+		resp:           resp,
+		db:             db,
+		books:          &books,
+		library:        library,
+		userRepo:       userRepo,
+		loans:          loans,
+		bookController: &config.BookController{DB: db, OnError: resp.Error, Output: resp.Negotiate},
+		userController: &adapter.UserController{UserRepo: userRepo, Loans: loans},
+		sessions:       sessions,
+		accounts:       service.NewAccountFlows(userRepo, adapter.NewPostgresUserTokenRepository(db), mail.NewSender(mailConfig), sessions, mailConfig),
+		apiKeys:        service.NewAPIKeyManager(apiKeyRepo, userRepo),
+		oidcLogin:      oidcLogin,
+		loginGuard:     loginGuard,
+		mfaManager:     service.NewMFAManager(adapter.NewPostgresMFARepository(db), userRepo, sessions, apiKeyRepo, loginGuard, mfaConfig),
+		mfaPolicy:      service.NewMFAPolicy(mfaConfig.RequiredRoles),
+		idempotency:    adapter.NewPostgresIdempotencyRepository(db),
+		idempotencyTTL: config.IdempotencyKeyTTL(),
+		requestTimeout: config.IdempotentRequestTimeout(),
+		loanRules:      config.LoanSettings(),
+		trustedProxies: trustedProxies,
+	}
 
-	r := chi.NewRouter()
-	service.GenerateUsers(50)
+	go sessions.Revocations.StartSweeper(context.Background(), time.Minute) // Работает, пока жив процесс
 
-	r.Use(middleware.Logger)
-	r.Get("/swagger/*", httpSwagger.WrapHandler)
-	r.Post("/api/register", service.Register)
-	r.Post("/api/login", service.Login)
-	r.Post("/api/users", userController.CreateUser)        // Создание пользователя
-	r.Get("/api/users/{id}", userController.GetUser)       // Получение пользователя по ID
-	r.Put("/api/users/{id}", userController.UpdateUser)    // Обновление пользователя
-	r.Delete("/api/users/{id}", userController.DeleteUser) // Удаление пользователя
-	r.Get("/api/users", userController.ListUsers)
+	service.GenerateUsers(userRepo, config.DemoUsers())
+	if err := service.InitTokenAuth(); err != nil {
+		log.Fatalf("Error configuring JWT keys: %v", err)
+	}
+	admin, err := config.AdminSettings()
+	if err == nil {
+		err = service.EnsureAdmin(userRepo, admin.Username, admin.Password)
+	}
+	if err != nil {
+		log.Fatalf("Error creating admin: %v", err)
+	}
 
-	r.Post("/api/book/take/{index}", controller.TakeBookHandler(resp, db, &books, library))
-	r.Delete("/api/book/return/{index}", controller.ReturnBook(resp, db, &books, library))
-	r.Get("/api/users", service.ListUsersHandler(resp))
+	return a.routes(config.APIVersionSettings(), config.ContractCheck())
+}
 
-	r.Post("/api/authors", controller.AddAuthorHandler(resp, library))
+// routes собирает корневой роутер; отделен от Router, чтобы маршруты можно было проверить без базы данных.
+// contractCheck — режим сверки с OpenAPI документом, см. config.ContractCheck.
+func (a *api) routes(versions config.APIVersionConfig, contractCheck string) *chi.Mux {
+	doc := apidoc.Build(apidoc.Info{
+		Title:          apiTitle,
+		Version:        "v2",
+		Description:    v1Notice(versions),
+		PathParamTypes: pathParamTypes,
+	}, allRoutes())
 
-	r.Post("/api/book", controller.AddBookHandler(resp, db, library, &books))
-	r.Get("/api/books", bookController.ListBook)
-	r.Put("/api/book/{index}", controller.UpdateBook(resp, db))
-	r.Get("/api/author", controller.ListAuthorsHandler(resp, library))
-	r.Get("/api/get-authors", controller.GetAuthorsHandler(resp, library))
+	r := chi.NewRouter()
+	r.Use(middle.RealIP(a.trustedProxies))
+	r.Use(problem.RequestID)
+	r.Use(middleware.Logger)
+	r.Use(validate.LimitBody(validate.MaxBodyBytes)) // Общий предел тела запроса; обработчики могут задать меньший
+	if contractCheck != "off" {
+		r.Use(apidoc.Contract(doc, contractCheck == "reject"))
+	}
+	r.NotFound(problem.NotFoundHandler)
+	r.MethodNotAllowed(problem.MethodNotAllowedHandler)
 
-	// Используем обработчики с middleware
+	r.Get("/.well-known/jwks.json", service.JWKSHandler)
+	r.Get("/openapi.json", apidoc.Handler(doc))
+
+	v1 := a.v1(versions)
+	r.Mount("/api/v1", v1)
+	r.Mount("/api/v2", a.v2())
+	// Адреса без версии остаются за v1, пока ими пользуются клиенты, ссылки в письмах и OIDC_REDIRECT_URL
+	r.Mount("/api", v1)
 
 	return r
 }
+
+// newVersionRouter создает роутер версии API с ответами об ошибках в формате problem
+func newVersionRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.NotFound(problem.NotFoundHandler)
+	r.MethodNotAllowed(problem.MethodNotAllowedHandler)
+	return r
+}
+
+// serveDoc добавляет к роутеру версии /openapi.json с описанием ее маршрутов
+func serveDoc(r chi.Router, info apidoc.Info, routes []apidoc.Route) {
+	info.Title = apiTitle
+	info.PathParamTypes = pathParamTypes
+	r.Get("/openapi.json", apidoc.Handler(apidoc.Build(info, routes)))
+}
+
+// v1Notice описывает сроки отключения v1 для документов
+func v1Notice(versions config.APIVersionConfig) string {
+	return "API v1 (/api/v1 and unversioned /api) is deprecated and will be removed after " +
+		versions.V1Sunset.Format("2006-01-02") + "; use /api/v2."
+}
+
+// publicAuthRoutes — регистрация, вход и восстановление доступа; одинаковы во всех версиях
+func (a *api) publicAuthRoutes(r chi.Router) {
+	r.Post("/register", service.Register(a.userRepo, a.accounts))
+	r.Post("/login", service.Login(a.userRepo, a.sessions, a.loginGuard, a.mfaManager))
+	r.Post("/login/mfa", service.LoginMFA(a.mfaManager))
+	r.Post("/token/refresh", service.RefreshHandler(a.userRepo, a.sessions))
+	r.Post("/email/verify", service.VerifyEmail(a.accounts))
+	r.Post("/password/forgot", service.ForgotPassword(a.accounts))
+	r.Post("/password/reset", service.ResetPassword(a.accounts))
+	if a.oidcLogin != nil {
+		r.Get("/oidc/login", service.OIDCStart(a.oidcLogin))
+		r.Get("/oidc/callback", service.OIDCCallback(a.oidcLogin))
+	}
+}
+
+// authenticate проверяет JWT или API ключ
+func (a *api) authenticate() func(http.Handler) http.Handler {
+	return middle.TokenAuthMiddleware(a.resp, a.sessions.Revocations, a.apiKeys)
+}
+
+// idempotent сохраняет ответы на запросы с Idempotency-Key, чтобы повторы киоска не выполнялись дважды
+func (a *api) idempotent() func(http.Handler) http.Handler {
+	return middle.Idempotency(a.resp, a.idempotency, a.idempotencyTTL, a.requestTimeout)
+}
+
+// accountRoutes — выход и второй фактор; доступны и тем, кому без второго фактора остальное закрыто
+func (a *api) accountRoutes(r chi.Router) {
+	r.Post("/logout", service.Logout(a.sessions))
+	r.Post("/logout/all", service.LogoutAll(a.sessions))
+	r.Post("/email/verify/resend", service.ResendVerification(a.accounts))
+
+	r.Post("/mfa/totp", service.EnrollTOTP(a.mfaManager))                        // Начало подключения TOTP
+	r.Post("/mfa/totp/confirm", service.ConfirmTOTP(a.mfaManager))               // Подтверждение и коды восстановления
+	r.Post("/mfa/recovery-codes", service.RegenerateRecoveryCodes(a.mfaManager)) // Новые коды восстановления
+	r.Delete("/mfa/totp", service.DisableTOTP(a.mfaManager))                     // Отключение TOTP
+}
+
+// userRoutes — пользователи, их сессии и API ключи
+func (a *api) userRoutes(r chi.Router) {
+	uc := a.userController
+
+	// Свою учетную запись может просматривать и изменять сам пользователь
+	r.With(middle.RequireSelfOrPermission(a.resp, "id", service.PermUsersManage)).
+		Get("/users/{id}", uc.GetUser) // Получение пользователя по ID
+	r.With(middle.RequireSelfOrPermission(a.resp, "id", service.PermUsersManage)).
+		Patch("/users/{id}", uc.PatchUser) // Частичное обновление пользователя
+	r.Route("/users/{id}/sessions", func(r chi.Router) {
+		r.Use(middle.RequireSelfOrPermission(a.resp, "id", service.PermUsersManage))
+		r.Get("/", service.ListSessions(a.sessions))                 // Активные сессии пользователя
+		r.Delete("/", service.RevokeSessions(a.sessions))            // Завершение всех сессий
+		r.Delete("/{sessionID}", service.RevokeSessions(a.sessions)) // Завершение одной сессии
+	})
+	r.Route("/users/{id}/api-keys", func(r chi.Router) {
+		r.Use(middle.RequireSelfOrPermission(a.resp, "id", service.PermUsersManage))
+		r.Get("/", service.ListAPIKeys(a.apiKeys))            // API ключи пользователя
+		r.Post("/", service.CreateAPIKey(a.apiKeys))          // Выпуск ключа
+		r.Delete("/{keyID}", service.RevokeAPIKey(a.apiKeys)) // Отзыв ключа
+	})
+
+	// Управление пользователями — только администраторы
+	r.Group(func(r chi.Router) {
+		r.Use(middle.RequirePermission(a.resp, service.PermUsersManage))
+
+		r.With(a.idempotent()).Post("/users", uc.CreateUser) // Создание пользователя
+
+		r.Put("/users/{id}", uc.UpdateUser)    // Обновление пользователя
+		r.Delete("/users/{id}", uc.DeleteUser) // Удаление пользователя
+		r.Get("/users", uc.ListUsers)
+		r.Route("/admin/users/{id}", func(r chi.Router) {
+			r.Get("/", uc.GetUserWithDeleted)                               // Получение пользователя, включая удаленного
+			r.Post("/restore", uc.RestoreUser)                              // Восстановление удаленного пользователя
+			r.Delete("/", uc.PurgeUser)                                     // Окончательное удаление пользователя
+			r.Post("/unlock", service.UnlockUser(a.userRepo, a.loginGuard)) // Снятие блокировки входа
+			r.Delete("/mfa", service.ResetUserMFA(a.mfaManager))            // Сброс второго фактора
+		})
+	})
+}
+
+// newOIDCLogin настраивает вход через OpenID Connect; без OIDC_ISSUER вход отключен. Если OIDC_ISSUER задан,
+// неверный OIDC_ROLE_MAP или недоступный провайдер — ошибка, чтобы сервис не запустился без настроенного входа.
+func newOIDCLogin(db *sql.DB, userRepo *adapter.PostgresUserRepository, sessions *service.SessionManager) (*service.OIDCLogin, error) {
+	cfg := config.OIDCSettings()
+	if cfg.Issuer == "" {
+		return nil, nil
+	}
+	roleMap, err := service.ParseRoleMap(cfg.RoleMap)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC_ROLE_MAP: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := oidc.NewClient(ctx, cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("discovery for %s: %w", cfg.Issuer, err)
+	}
+	return service.NewOIDCLogin(client, userRepo, adapter.NewPostgresExternalIdentityRepository(db), sessions, roleMap), nil
+}
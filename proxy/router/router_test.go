@@ -0,0 +1,32 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/apidoc"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	a := &api{
+		resp:      &controller.Respond{},
+		library:   controller.NewLibrary(),
+		sessions:  &service.SessionManager{},
+		oidcLogin: &service.OIDCLogin{}, // Маршруты OIDC регистрируются только при настроенном провайдере
+	}
+	root := a.routes(config.APIVersionConfig{V1DeprecatedAt: time.Now(), V1Sunset: time.Now().AddDate(0, 6, 0)}, "reject")
+
+	undocumented, unrouted, err := apidoc.Missing(root, allRoutes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range undocumented {
+		t.Errorf("%s is routed but missing from the OpenAPI document, describe it in openapi.go", route)
+	}
+	for _, route := range unrouted {
+		t.Errorf("%s is described in openapi.go but not routed", route)
+	}
+}
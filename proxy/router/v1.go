@@ -0,0 +1,64 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/config"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/apidoc"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/middle"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+// v1 — исходные адреса и форматы ответов. Версия устарела: новые клиенты используют /api/v2,
+// а ответы v1 несут заголовки Deprecation и Sunset.
+func (a *api) v1(versions config.APIVersionConfig) http.Handler {
+	r := newVersionRouter()
+	r.Use(middle.Deprecated(versions.V1DeprecatedAt, versions.V1Sunset, "/api/v2"))
+
+	// Публичные маршруты
+	r.Group(func(r chi.Router) {
+		a.publicAuthRoutes(r)
+		r.Get("/books", a.bookController.ListBook)
+		r.Get("/author", controller.ListAuthorsHandler(a.resp, a.library))
+		r.Get("/get-authors", controller.GetAuthorsHandler(a.resp, a.library))
+	})
+
+	// Маршруты, требующие JWT токена
+	r.Group(func(r chi.Router) {
+		r.Use(a.authenticate())
+		a.accountRoutes(r)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middle.RequireMFA(a.resp, a.mfaPolicy))
+			a.userRoutes(r)
+
+			// Выдача и возврат книг
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequirePermission(a.resp, service.PermLoansOwn, service.PermLoansOnBehalf))
+				r.Use(a.idempotent())
+
+				r.Post("/book/take/{index}", controller.TakeBookHandler(a.resp, a.db, a.books, a.library))
+				r.Delete("/book/return/{index}", controller.ReturnBook(a.resp, a.db, a.books, a.library))
+			})
+
+			// Ведение каталога — библиотекари и администраторы
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequirePermission(a.resp, service.PermBooksWrite))
+
+				r.With(a.idempotent()).Post("/authors", controller.AddAuthorHandler(a.resp, a.library))
+
+				r.With(a.idempotent()).Post("/book", controller.AddBookHandler(a.resp, a.db, a.library, a.books))
+				r.Put("/book/{index}", controller.UpdateBook(a.resp, a.db))
+				r.Patch("/book/{index}", controller.PatchBook(a.resp, a.db))
+				r.Delete("/book/{index}", controller.DeleteBook(a.resp, a.db, a.books, a.library))
+				r.Get("/book/trash", controller.ListDeletedBooks(a.resp, a.db))
+				r.Post("/book/{index}/restore", controller.RestoreBook(a.resp, a.db, a.books, a.library))
+			})
+		})
+	})
+
+	serveDoc(r, apidoc.Info{Version: "v1", Description: v1Notice(versions), BasePath: "/api/v1"}, v1Routes())
+	return r
+}
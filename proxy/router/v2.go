@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/controller"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/apidoc"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/middle"
+	"studentgit.kata.academy/Zhodaran/go-kata/proxy/internal/modules/auth/service"
+)
+
+// v2 — книги и авторы как ресурсы: /books/{index}, выдача книги — вложенный ресурс /books/{index}/loan,
+// ее продление — /books/{index}/loan/renew, бронь — /books/{index}/hold.
+// Пользователи и вход устроены так же, как в v1.
+func (a *api) v2() http.Handler {
+	r := newVersionRouter()
+
+	// Публичные маршруты
+	r.Group(func(r chi.Router) {
+		a.publicAuthRoutes(r)
+		r.Get("/authors", controller.ListAuthors(a.resp, a.library))
+
+		// Вход не обязателен; выдачи и брони с данными читателей встраиваются только библиотекарям
+		r.Group(func(r chi.Router) {
+			r.Use(middle.Optional(a.authenticate()), middle.Optional(middle.RequireMFA(a.resp, a.mfaPolicy)))
+			r.Get("/books", controller.ListBooks(a.resp, a.db, a.loans))
+			r.Get("/books/{index}", controller.GetBook(a.resp, a.db, a.loans))
+		})
+	})
+
+	// Маршруты, требующие JWT токена
+	r.Group(func(r chi.Router) {
+		r.Use(a.authenticate())
+		a.accountRoutes(r)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middle.RequireMFA(a.resp, a.mfaPolicy))
+			a.userRoutes(r)
+
+			// Выдача, возврат и бронирование книг
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequirePermission(a.resp, service.PermLoansOwn, service.PermLoansOnBehalf))
+				r.Use(a.idempotent())
+
+				r.Post("/books/{index}/loan", controller.CreateLoan(a.resp, a.db, a.books, a.library))
+				r.Delete("/books/{index}/loan", controller.DeleteLoan(a.resp, a.db, a.books, a.library))
+				r.Post("/books/{index}/hold", controller.CreateHold(a.resp, a.db))
+				r.Delete("/books/{index}/hold", controller.DeleteHold(a.resp, a.db))
+			})
+
+			r.With(
+				middle.RequirePermission(a.resp, service.PermLoansRenew),
+				a.idempotent(),
+			).Post("/books/{index}/loan/renew", controller.RenewLoan(a.resp, a.db, a.loanRules))
+
+			// Пакет операций; права на каждую операцию проверяются отдельно
+			r.With(
+				middle.RequirePermission(a.resp, service.PermLoansOwn, service.PermLoansOnBehalf, service.PermBooksWrite),
+				a.idempotent(),
+			).Post("/books/batch", controller.BatchBooks(a.resp, a.db, a.books, a.library))
+
+			// Ведение каталога — библиотекари и администраторы
+			r.Group(func(r chi.Router) {
+				r.Use(middle.RequirePermission(a.resp, service.PermBooksWrite))
+
+				r.With(a.idempotent()).Post("/authors", controller.CreateAuthor(a.resp, a.library))
+
+				r.With(a.idempotent()).Post("/books", controller.CreateBook(a.resp, a.db, a.library, a.books))
+				r.Put("/books/{index}", controller.UpdateBook(a.resp, a.db))
+				r.Patch("/books/{index}", controller.PatchBook(a.resp, a.db))
+				r.Delete("/books/{index}", controller.DeleteBook(a.resp, a.db, a.books, a.library))
+				r.Get("/books/trash", controller.ListDeletedBooks(a.resp, a.db))
+				r.Post("/books/{index}/restore", controller.RestoreBook(a.resp, a.db, a.books, a.library))
+			})
+		})
+	})
+
+	serveDoc(r, apidoc.Info{Version: "v2", BasePath: "/api/v2"}, v2Routes())
+	return r
+}